@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Endpoints an API key can be granted. Each covers every method and sub-path
+// registered under it.
+var knownEndpoints = []string{
+	"/check-license-plate",
+	"/check-license-plates/batch",
+	"/jobs",
+	"/metrics",
+	"/plates",
+	"/usage",
+	"/watchlist",
+}
+
+// apiKeyConfig is one entry of the API key file.
+type apiKeyConfig struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	// RateLimit is in requests per second with a bucket of Burst requests;
+	// zero uses the per-IP defaults.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	Burst     int     `json:"burst,omitempty"`
+	// Quotas count lookups (each plate of a batch is one); zero is unlimited.
+	DailyQuota   int64 `json:"daily_quota,omitempty"`
+	MonthlyQuota int64 `json:"monthly_quota,omitempty"`
+	// Endpoints lists the endpoints the key may call; empty allows all.
+	Endpoints []string `json:"endpoints,omitempty"`
+	// Admin keys may read the usage of every key.
+	Admin bool `json:"admin,omitempty"`
+}
+
+// APIKey is an authenticated caller.
+type APIKey struct {
+	apiKeyConfig
+	limiter *RateLimiter
+}
+
+func (k *APIKey) allows(endpoint string) bool {
+	return len(k.Endpoints) == 0 || slices.Contains(k.Endpoints, endpoint)
+}
+
+// APIKeyStore holds the configured API keys.
+type APIKeyStore struct {
+	keys   []*APIKey
+	byHash map[[sha256.Size]byte]*APIKey
+}
+
+// apiKeys authenticates requests; it is built in main and stays nil when no
+// API key file is configured, which leaves every endpoint open.
+var apiKeys *APIKeyStore
+
+// LoadAPIKeys reads a JSON file of the form {"keys": [{"name": ..., "key": ...}]}.
+func LoadAPIKeys(path string) (*APIKeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading API key file: %w", err)
+	}
+
+	var file struct {
+		Keys []apiKeyConfig `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing API key file: %w", err)
+	}
+	if len(file.Keys) == 0 {
+		return nil, fmt.Errorf("API key file %s lists no keys", path)
+	}
+
+	store := &APIKeyStore{byHash: make(map[[sha256.Size]byte]*APIKey)}
+	names := make(map[string]bool)
+	for i, cfg := range file.Keys {
+		if cfg.Name == "" || cfg.Key == "" {
+			return nil, fmt.Errorf("API key %d: name and key are required", i+1)
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("API key %q: duplicate name", cfg.Name)
+		}
+		names[cfg.Name] = true
+		if cfg.RateLimit < 0 || cfg.Burst < 0 || cfg.DailyQuota < 0 || cfg.MonthlyQuota < 0 {
+			return nil, fmt.Errorf("API key %q: limits must not be negative", cfg.Name)
+		}
+		for _, endpoint := range cfg.Endpoints {
+			if !slices.Contains(knownEndpoints, endpoint) {
+				return nil, fmt.Errorf("API key %q: unknown endpoint %q (known: %s)", cfg.Name, endpoint, strings.Join(knownEndpoints, ", "))
+			}
+		}
+
+		hash := sha256.Sum256([]byte(cfg.Key))
+		if _, ok := store.byHash[hash]; ok {
+			return nil, fmt.Errorf("API key %q: key is already used by another entry", cfg.Name)
+		}
+
+		key := &APIKey{apiKeyConfig: cfg, limiter: newKeyLimiter(cfg)}
+		store.keys = append(store.keys, key)
+		store.byHash[hash] = key
+	}
+	return store, nil
+}
+
+func newKeyLimiter(cfg apiKeyConfig) *RateLimiter {
+	if cfg.RateLimit == 0 {
+		return NewRateLimiter(10, 100*time.Millisecond)
+	}
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = max(1, int(cfg.RateLimit))
+	}
+	return NewRateLimiter(burst, time.Duration(float64(time.Second)/cfg.RateLimit))
+}
+
+// Authenticate returns the key matching token. Keys are looked up by their
+// SHA-256 digest so the comparison does not depend on how much of a guess
+// matches a real key.
+func (s *APIKeyStore) Authenticate(token string) (*APIKey, bool) {
+	key, ok := s.byHash[sha256.Sum256([]byte(token))]
+	return key, ok
+}
+
+// Keys returns every configured key in file order.
+func (s *APIKeyStore) Keys() []*APIKey {
+	return s.keys
+}
+
+// Named returns the key called name, or nil.
+func (s *APIKeyStore) Named(name string) *APIKey {
+	for _, key := range s.keys {
+		if key.Name == name {
+			return key
+		}
+	}
+	return nil
+}
+
+type apiKeyContextKey struct{}
+
+func withAPIKey(ctx context.Context, key *APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// apiKeyFrom returns the key that authenticated the request ctx belongs to,
+// or nil when authentication is off.
+func apiKeyFrom(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
+
+// requestAPIKey reads the key from "Authorization: Bearer <key>" or
+// "X-API-Key: <key>".
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// requireAPIKey authenticates requests to endpoint when API keys are
+// configured and passes them through untouched otherwise.
+func requireAPIKey(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiKeys == nil {
+			next(w, r)
+			return
+		}
+
+		token := requestAPIKey(r)
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			http.Error(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+		key, ok := apiKeys.Authenticate(token)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if !key.allows(endpoint) {
+			http.Error(w, "API key is not allowed to use "+endpoint, http.StatusForbidden)
+			return
+		}
+
+		usageStore.RecordRequest(key.Name)
+		next(w, r.WithContext(withAPIKey(r.Context(), key)))
+	}
+}
+
+// requestLimiter returns the rate limiter for r: the caller's API key when
+// authenticated, otherwise its client IP.
+func requestLimiter(r *http.Request) (*RateLimiter, string) {
+	if key := apiKeyFrom(r.Context()); key != nil {
+		return key.limiter, "key"
+	}
+	return ipRateLimiter.GetLimiter(getClientIP(r)), "ip"
+}
+
+// consumeQuota charges one lookup to the key in ctx, if any.
+func consumeQuota(ctx context.Context) error {
+	key := apiKeyFrom(ctx)
+	if key == nil {
+		return nil
+	}
+	return usageStore.Consume(key, time.Now())
+}
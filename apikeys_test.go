@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/internal/fakecsgt"
+)
+
+func writeAPIKeyFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	store, err := LoadAPIKeys(writeAPIKeyFile(t, `{"keys": [
+		{"name": "app", "key": "secret-app", "rate_limit": 2, "daily_quota": 100, "endpoints": ["/check-license-plate", "/usage"]},
+		{"name": "ops", "key": "secret-ops", "admin": true}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(store.Keys()); got != 2 {
+		t.Fatalf("got %d keys, want 2", got)
+	}
+
+	app, ok := store.Authenticate("secret-app")
+	if !ok || app.Name != "app" || app != store.Named("app") {
+		t.Fatalf("Authenticate(secret-app) = %v, %v", app, ok)
+	}
+	if !app.allows("/usage") || app.allows("/jobs") {
+		t.Errorf("app allows %v, want only its endpoints", app.Endpoints)
+	}
+	if app.limiter.Limit() != 2 {
+		t.Errorf("app burst = %d, want its rate limit", app.limiter.Limit())
+	}
+	ops := store.Named("ops")
+	if ops == nil || !ops.Admin || !ops.allows("/jobs") || ops.limiter.Limit() != 10 {
+		t.Errorf("ops = %+v, want an admin allowed everywhere at the default limit", ops)
+	}
+	if _, ok := store.Authenticate("secret-ap"); ok {
+		t.Error("a prefix of a key authenticated")
+	}
+
+	for name, content := range map[string]string{
+		"no keys":          `{"keys": []}`,
+		"not json":         `keys: []`,
+		"missing key":      `{"keys": [{"name": "app"}]}`,
+		"duplicate name":   `{"keys": [{"name": "app", "key": "a"}, {"name": "app", "key": "b"}]}`,
+		"duplicate key":    `{"keys": [{"name": "app", "key": "a"}, {"name": "ops", "key": "a"}]}`,
+		"negative quota":   `{"keys": [{"name": "app", "key": "a", "daily_quota": -1}]}`,
+		"unknown endpoint": `{"keys": [{"name": "app", "key": "a", "endpoints": ["/admin"]}]}`,
+	} {
+		if _, err := LoadAPIKeys(writeAPIKeyFile(t, content)); err == nil {
+			t.Errorf("%s: LoadAPIKeys succeeded", name)
+		}
+	}
+	if _, err := LoadAPIKeys(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadAPIKeys succeeded without a file")
+	}
+}
+
+// useAPIKeys turns authentication on with the keys in content and a usage
+// store in a temporary directory.
+func useAPIKeys(t *testing.T, content string) {
+	t.Helper()
+	store, err := LoadAPIKeys(writeAPIKeyFile(t, content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, err := NewUsageStore(filepath.Join(t.TempDir(), "usage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedKeys, savedUsage := apiKeys, usageStore
+	apiKeys, usageStore = store, usage
+	t.Cleanup(func() {
+		usage.Close()
+		apiKeys, usageStore = savedKeys, savedUsage
+	})
+}
+
+func lookupWithKey(t *testing.T, header, value, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/check-license-plate", strings.NewReader(body))
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	rec := httptest.NewRecorder()
+	requireAPIKey("/check-license-plate", licensePlateHandler)(rec, req)
+	return rec
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	useFakeUpstream(t, fakecsgt.Config{})
+	useAPIKeys(t, `{"keys": [
+		{"name": "app", "key": "secret-app", "daily_quota": 2},
+		{"name": "reader", "key": "secret-reader", "endpoints": ["/usage"]}
+	]}`)
+	const body = `{"license_plate": "30A12345", "vehicle_type": "1"}`
+
+	tests := []struct {
+		name          string
+		header, value string
+		status        int
+		challenge     bool // answers with WWW-Authenticate
+	}{
+		{name: "missing key", status: http.StatusUnauthorized, challenge: true},
+		{name: "invalid key", header: "Authorization", value: "Bearer wrong", status: http.StatusUnauthorized, challenge: true},
+		{name: "other scheme", header: "Authorization", value: "Basic secret-app", status: http.StatusUnauthorized, challenge: true},
+		{name: "endpoint not granted", header: "X-API-Key", value: "secret-reader", status: http.StatusForbidden},
+		{name: "bearer token", header: "Authorization", value: "Bearer secret-app", status: http.StatusOK},
+		{name: "x-api-key header", header: "X-API-Key", value: "secret-app", status: http.StatusOK},
+		{name: "over quota", header: "X-API-Key", value: "secret-app", status: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := lookupWithKey(t, tt.header, tt.value, body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if got := rec.Header().Get("WWW-Authenticate") != ""; got != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want a challenge %v", rec.Header().Get("WWW-Authenticate"), tt.challenge)
+			}
+			if tt.status == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+				t.Error("no Retry-After on an exhausted quota")
+			}
+		})
+	}
+}
+
+func TestUsageAccounting(t *testing.T) {
+	useFakeUpstream(t, fakecsgt.Config{})
+	useAPIKeys(t, `{"keys": [
+		{"name": "app", "key": "secret-app", "daily_quota": 10},
+		{"name": "ops", "key": "secret-ops", "admin": true}
+	]}`)
+
+	for _, body := range []string{
+		`{"license_plate": "30A12345", "vehicle_type": "1"}`,
+		`{"license_plate": "30A-123.45", "vehicle_type": "1"}`, // cached
+		`{"license_plate": "not a plate"}`,                     // rejected before any lookup
+	} {
+		lookupWithKey(t, "X-API-Key", "secret-app", body)
+	}
+
+	u := usageStore.Usage("app")
+	if u.Requests != 3 || u.Lookups != 2 || u.CaptchaAttempts != 1 {
+		t.Errorf("usage = %+v, want 3 requests, 2 lookups and 1 captcha attempt", u)
+	}
+	today := time.Now().In(csgt.Location).Format(dayLayout)
+	if u.Daily[today] != 2 {
+		t.Errorf("daily usage = %v, want 2 on %s", u.Daily, today)
+	}
+
+	usage := func(token string) []usageReport {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/usage", nil)
+		req.Header.Set("X-API-Key", token)
+		rec := httptest.NewRecorder()
+		requireAPIKey("/usage", usageHandler)(rec, req)
+		var resp struct{ Keys []usageReport }
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Keys
+	}
+	own := usage("secret-app")
+	if len(own) != 1 || own[0].Name != "app" || own[0].Today.Used != 2 || own[0].Today.Remaining == nil || *own[0].Today.Remaining != 8 {
+		t.Errorf("/usage for app = %+v, want its own usage with 8 lookups left today", own)
+	}
+	if all := usage("secret-ops"); len(all) != 2 {
+		t.Errorf("/usage for an admin = %+v, want every key", all)
+	}
+
+	// Counters survive a restart.
+	if err := usageStore.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := NewUsageStore(usageStore.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if got := reloaded.Usage("app"); got.Lookups != 2 || got.Daily[today] != 2 {
+		t.Errorf("reloaded usage = %+v, want the saved counters", got)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchWorkers  = 4
+	defaultBatchMaxItems = 500
+
+	// batchWriteWindow is how long each streamed line may take to write; the
+	// deadline is pushed forward after every line so long batches are not cut
+	// off by the server's WriteTimeout.
+	batchWriteWindow = 2 * time.Minute
+)
+
+var (
+	batchWorkers  = defaultBatchWorkers
+	batchMaxItems = defaultBatchMaxItems
+)
+
+// batchItemResult is one NDJSON line of a batch response.
+type batchItemResult struct {
+	Type         string `json:"type"`
+	Index        int    `json:"index"`
+	LicensePlate string `json:"license_plate"`
+	VehicleType  string `json:"vehicle_type"`
+	lookupResponse
+	ItemError string `json:"item_error,omitempty"`
+}
+
+// batchSummary is the final NDJSON line of a batch response.
+type batchSummary struct {
+	Type       string `json:"type"`
+	Total      int    `json:"total"`
+	Succeeded  int    `json:"succeeded"`
+	Failed     int    `json:"failed"`
+	Cached     int    `json:"cached"`
+	Violations int    `json:"violations"`
+	Attempts   int    `json:"attempts"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var items []lookupRequest
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 {
+		http.Error(w, "Batch is empty", http.StatusBadRequest)
+		return
+	}
+	if len(items) > batchMaxItems {
+		http.Error(w, fmt.Sprintf("Batch too large: %d items, at most %d allowed", len(items), batchMaxItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	ctx := rateLimitContext(r.Context())
+	limiter, limiterName := requestLimiter(r)
+	started := time.Now()
+
+	jobs := make(chan int)
+	results := make(chan batchItemResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < min(batchWorkers, len(items)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results <- runBatchItem(ctx, limiter, limiterName, index, items[index])
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := range items {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	setRateLimitHeaders(w, limiter)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	summary := batchSummary{Type: "summary", Total: len(items)}
+
+	for result := range results {
+		if result.ItemError != "" {
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+			summary.Violations += result.ViolationCount
+			if result.Cached {
+				summary.Cached++
+			}
+		}
+		summary.Attempts += result.Attempts
+
+		writeBatchLine(rc, encoder, result)
+	}
+
+	summary.DurationMS = time.Since(started).Milliseconds()
+	writeBatchLine(rc, encoder, summary)
+}
+
+func runBatchItem(ctx context.Context, limiter *RateLimiter, limiterName string, index int, item lookupRequest) batchItemResult {
+	result := batchItemResult{
+		Type:         "result",
+		Index:        index,
+		LicensePlate: item.LicensePlate,
+		VehicleType:  item.VehicleType,
+	}
+
+	licensePlate, err := item.parsedPlate()
+	if err != nil {
+		result.ItemError = err.Error()
+		return result
+	}
+	filter, err := item.violationFilter()
+	if err != nil {
+		result.ItemError = err.Error()
+		return result
+	}
+
+	// Every valid plate counts against the caller's rate limit and quota.
+	if err := waitForToken(ctx, limiter, limiterName); err != nil {
+		result.ItemError = err.Error()
+		return result
+	}
+	if err := consumeQuota(ctx); err != nil {
+		result.ItemError = err.Error()
+		return result
+	}
+
+	if lookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lookupTimeout)
+		defer cancel()
+	}
+
+	outcome, err := lookupLicensePlate(ctx, licensePlate, item.VehicleType, item.ForceRefresh)
+	if err != nil {
+		result.ItemError = err.Error()
+		if outcome != nil {
+			result.Attempts = outcome.Attempts
+		}
+		return result
+	}
+
+	result.lookupResponse = newLookupResponse(licensePlate, outcome, filter)
+	return result
+}
+
+func writeBatchLine(rc *http.ResponseController, encoder *json.Encoder, line interface{}) {
+	_ = rc.SetWriteDeadline(time.Now().Add(batchWriteWindow))
+	if err := encoder.Encode(line); err != nil {
+		log.Printf("batch: error writing line: %v", err)
+		return
+	}
+	_ = rc.Flush()
+}
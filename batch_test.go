@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/internal/fakecsgt"
+)
+
+// useFakeUpstream points lookups at a fake csgt.vn configured by cfg, with a
+// solver that always reads the captcha right and usage charged to API keys,
+// and gives them a fresh result cache and per-IP limiter.
+func useFakeUpstream(t *testing.T, cfg fakecsgt.Config) {
+	t.Helper()
+	const answer = "k7mxpa"
+	if cfg.Scenario == "" {
+		cfg.Scenario = fakecsgt.ScenarioNone
+	}
+	cfg.CaptchaAnswer = answer
+	srv := httptest.NewServer(fakecsgt.NewServer(cfg).Handler())
+	t.Cleanup(srv.Close)
+
+	savedClient, savedCache, savedLimiter := lookupClient, resultCache, ipRateLimiter
+	lookupClient = csgt.NewClient(
+		csgt.WithBaseURL(srv.URL+"/"),
+		csgt.WithSolver(csgt.SolverFunc(func(context.Context, image.Image) (string, error) {
+			return answer, nil
+		})),
+		csgt.WithMaxAttempts(1),
+		csgt.WithObserver(usageObserver{}),
+	)
+	resultCache = NewLookupCache(time.Minute, time.Minute, nil)
+	ipRateLimiter = NewIPRateLimiter(1000, time.Millisecond, time.Minute, 100)
+	t.Cleanup(func() {
+		ipRateLimiter.Close()
+		lookupClient, resultCache, ipRateLimiter = savedClient, savedCache, savedLimiter
+	})
+}
+
+// postBatch sends body to the batch endpoint and returns the response with
+// its result lines and summary.
+func postBatch(t *testing.T, body string) (*http.Response, []batchItemResult, batchSummary) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	batchHandler(rec, httptest.NewRequest(http.MethodPost, "/check-license-plates/batch", strings.NewReader(body)))
+	resp := rec.Result()
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil, batchSummary{}
+	}
+
+	var (
+		results []batchItemResult
+		summary batchSummary
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line struct{ Type string }
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		if summary.Type != "" {
+			t.Fatalf("line %q after the summary", scanner.Text())
+		}
+		switch line.Type {
+		case "result":
+			var result batchItemResult
+			if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			results = append(results, result)
+		case "summary":
+			if err := json.Unmarshal(scanner.Bytes(), &summary); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			t.Fatalf("unexpected line %q", scanner.Text())
+		}
+	}
+	if summary.Type == "" {
+		t.Fatal("no summary line")
+	}
+	return resp, results, summary
+}
+
+func TestBatchPartialFailures(t *testing.T) {
+	useFakeUpstream(t, fakecsgt.Config{PlateScenarios: map[string]fakecsgt.Scenario{
+		"98B378578": fakecsgt.ScenarioViolations,
+		"51F12345":  fakecsgt.ScenarioMalformedJSON,
+	}})
+
+	_, results, summary := postBatch(t, `[
+		{"license_plate": "98B3-785.78", "vehicle_type": "2"},
+		{"license_plate": "not a plate", "vehicle_type": "1"},
+		{"license_plate": "51F12345", "vehicle_type": "1"},
+		{"license_plate": "30A12345", "vehicle_type": "1"},
+		{"license_plate": "30A12345", "vehicle_type": "1", "since": "yesterday"}
+	]`)
+
+	if len(results) != 5 {
+		t.Fatalf("got %d results, want 5", len(results))
+	}
+	byIndex := make(map[int]batchItemResult)
+	for _, result := range results {
+		byIndex[result.Index] = result
+	}
+	for index, failed := range []bool{false, true, true, false, true} {
+		result, ok := byIndex[index]
+		if !ok {
+			t.Errorf("no result for item %d", index)
+			continue
+		}
+		if failed != (result.ItemError != "") {
+			t.Errorf("item %d: item_error = %q, want failure %v", index, result.ItemError, failed)
+		}
+		if !failed && !result.Success {
+			t.Errorf("item %d: success = false", index)
+		}
+	}
+	if got := byIndex[0].ViolationCount; got == 0 {
+		t.Error("item 0: no violations, want some")
+	}
+	if got := byIndex[2].Attempts; got != 1 {
+		t.Errorf("failed upstream lookup reported %d attempts, want 1", got)
+	}
+
+	want := batchSummary{Type: "summary", Total: 5, Succeeded: 2, Failed: 3, Violations: byIndex[0].ViolationCount, Attempts: 3}
+	summary.DurationMS = 0
+	if summary != want {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+}
+
+func TestBatchSizeLimit(t *testing.T) {
+	saved := batchMaxItems
+	batchMaxItems = 2
+	defer func() { batchMaxItems = saved }()
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty", `[]`, http.StatusBadRequest},
+		{"not an array", `{"license_plate": "30A12345"}`, http.StatusBadRequest},
+		{"too many items", `[{"license_plate": "30A12345"}, {"license_plate": "30A12346"}, {"license_plate": "30A12347"}]`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _, _ := postBatch(t, tt.body)
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchResultOrder(t *testing.T) {
+	plates := []string{"30A12345", "30A12346", "30A12347", "30A12348", "30A12349", "30A12350"}
+	items := make([]lookupRequest, len(plates))
+	for i, p := range plates {
+		items[i] = lookupRequest{LicensePlate: p, VehicleType: "1"}
+	}
+	body, err := json.Marshal(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 3} {
+		useFakeUpstream(t, fakecsgt.Config{})
+		saved := batchWorkers
+		batchWorkers = workers
+
+		_, results, summary := postBatch(t, string(body))
+		batchWorkers = saved
+
+		if summary.Succeeded != len(plates) {
+			t.Fatalf("%d workers: summary = %+v, want %d successes", workers, summary, len(plates))
+		}
+		seen := make(map[int]bool)
+		for i, result := range results {
+			// Results stream as they finish; each carries its item's index.
+			if workers == 1 && result.Index != i {
+				t.Errorf("1 worker: line %d is item %d, want items in order", i, result.Index)
+			}
+			if seen[result.Index] {
+				t.Errorf("%d workers: item %d answered twice", workers, result.Index)
+			}
+			seen[result.Index] = true
+			if result.LicensePlate != plates[result.Index] || result.Plate == nil || result.Plate.Compact() != plates[result.Index] {
+				t.Errorf("%d workers: item %d is %q, want %q", workers, result.Index, result.LicensePlate, plates[result.Index])
+			}
+		}
+		if len(seen) != len(plates) {
+			t.Errorf("%d workers: got %d distinct items, want %d", workers, len(seen), len(plates))
+		}
+	}
+}
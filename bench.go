@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"LicensePlatecheck/csgt"
+)
+
+// confusableGroups are glyphs OCR commonly mixes up; bench-captcha reports
+// how each of them was read.
+var confusableGroups = []string{"0O", "1lI", "5S"}
+
+// Confusion matrix columns besides the glyphs of a group.
+const (
+	confusionOther   = "other"   // read as a glyph outside the group
+	confusionMissing = "missing" // dropped from the read text
+)
+
+// benchReport is the outcome of one bench-captcha run.
+type benchReport struct {
+	Dir     string         `json:"dir"`
+	Samples int            `json:"samples"`
+	RanAt   time.Time      `json:"ran_at"`
+	Solvers []*solverBench `json:"solvers"`
+}
+
+// solverBench is how one solver did over the labelled captchas with one
+// preprocessing pipeline, or with the vote across them.
+type solverBench struct {
+	Solver        string  `json:"solver"`
+	Variant       string  `json:"variant"` // preprocessing pipeline, or the vote across them
+	Samples       int     `json:"samples"`
+	Read          int     `json:"read"` // runs that produced text
+	Exact         int     `json:"exact"`
+	ExactAccuracy float64 `json:"exact_accuracy"`
+	Chars         int     `json:"chars"`
+	CharsCorrect  int     `json:"chars_correct"`
+	CharAccuracy  float64 `json:"char_accuracy"`
+	LatencyP50MS  float64 `json:"latency_p50_ms"`
+	LatencyP95MS  float64 `json:"latency_p95_ms"`
+
+	// Confusion maps each group, e.g. "0/O", to expected glyph to what it
+	// was read as to count.
+	Confusion map[string]map[string]map[string]int `json:"confusion"`
+
+	latencies []time.Duration
+}
+
+// benchSample is a decoded labelled captcha, before preprocessing.
+type benchSample struct {
+	answer string
+	img    image.Image
+}
+
+// runBenchCaptcha implements "bench-captcha": it runs every configured
+// solver over a directory of labelled captchas and reports how each did.
+func runBenchCaptcha(args []string) error {
+	fs := flag.NewFlagSet("bench-captcha", flag.ContinueOnError)
+	dir := fs.String("dir", "", "directory of labelled captchas (a CAPTCHA_DATASET_DIR or images named <answer>.png)")
+	solvers := fs.String("solvers", "", "solver chain to measure instead of CAPTCHA_SOLVERS/CAPTCHA_SOLVER_CONFIG, e.g. tesseract:10s,ocrspace")
+	preprocess := fs.String("preprocess", os.Getenv("CAPTCHA_PREPROCESS"), "preprocessing pipelines to measure, as in CAPTCHA_PREPROCESS")
+	vote := fs.String("vote", os.Getenv("CAPTCHA_VOTE"), "how the reads of several pipelines are combined: majority or confidence")
+	format := fs.String("format", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return errors.New("-dir is required")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	var configs []csgt.SolverConfig
+	var err error
+	if *solvers != "" {
+		configs, err = csgt.ParseSolverSpec(*solvers)
+		setOCRSpaceKey(configs, os.Getenv("OCR_API_KEY"))
+	} else {
+		configs, err = loadSolverConfigs(os.Getenv("OCR_API_KEY"))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid captcha solver configuration: %w", err)
+	}
+	pipelines, mode, err := parsePreprocessing(*preprocess, *vote)
+	if err != nil {
+		return fmt.Errorf("invalid captcha preprocessing configuration: %w", err)
+	}
+
+	samples, err := loadBenchSamples(*dir)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("no labelled captchas in %s", *dir)
+	}
+
+	report := &benchReport{Dir: *dir, Samples: len(samples), RanAt: time.Now()}
+	for _, cfg := range configs {
+		solver, err := csgt.NewSolver(cfg)
+		if err != nil {
+			return err
+		}
+		report.Solvers = append(report.Solvers, benchSolver(solver, pipelines, mode, samples)...)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	writeBenchText(os.Stdout, report)
+	return nil
+}
+
+// loadBenchSamples reads the labelled captchas in dir.
+func loadBenchSamples(dir string) ([]benchSample, error) {
+	labelled, err := csgt.ReadLabeledCaptchas(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", dir, err)
+	}
+
+	samples := make([]benchSample, 0, len(labelled))
+	for _, captcha := range labelled {
+		f, err := os.Open(captcha.Path)
+		if err != nil {
+			return nil, err
+		}
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", captcha.Path, err)
+		}
+		samples = append(samples, benchSample{
+			answer: captcha.Answer,
+			img:    img,
+		})
+	}
+	return samples, nil
+}
+
+// benchSolver runs solver over every sample, reading each through all
+// pipelines in parallel as lookups do. It reports every pipeline and, when
+// there are several, their vote.
+func benchSolver(solver csgt.CaptchaSolver, pipelines []csgt.Pipeline, vote string, samples []benchSample) []*solverBench {
+	benches := make([]*solverBench, len(pipelines))
+	for i, pipeline := range pipelines {
+		benches[i] = newSolverBench(solver.Name(), pipeline.Name)
+	}
+	var voted *solverBench
+	if len(pipelines) > 1 {
+		voted = newSolverBench(solver.Name(), vote+" vote")
+		benches = append(benches, voted)
+	}
+
+	for _, sample := range samples {
+		started := time.Now()
+		reads := csgt.SolveVariants(context.Background(), solver, pipelines, sample.img)
+		elapsed := time.Since(started)
+
+		for i, read := range reads {
+			benches[i].latencies = append(benches[i].latencies, read.Duration)
+			benches[i].add(sample.answer, readText(read))
+		}
+		if voted != nil {
+			winner, _ := csgt.Vote(reads, vote)
+			voted.latencies = append(voted.latencies, elapsed)
+			voted.add(sample.answer, readText(winner))
+		}
+	}
+
+	for _, bench := range benches {
+		bench.ExactAccuracy = ratio(bench.Exact, bench.Samples)
+		bench.CharAccuracy = ratio(bench.CharsCorrect, bench.Chars)
+		bench.LatencyP50MS = milliseconds(percentile(bench.latencies, 0.50))
+		bench.LatencyP95MS = milliseconds(percentile(bench.latencies, 0.95))
+	}
+	return benches
+}
+
+func newSolverBench(solver, variant string) *solverBench {
+	return &solverBench{
+		Solver:    solver,
+		Variant:   variant,
+		Confusion: make(map[string]map[string]map[string]int),
+	}
+}
+
+// readText is the text of read, empty when it failed.
+func readText(read csgt.Read) string {
+	if read.Err != nil {
+		return ""
+	}
+	return read.Text
+}
+
+// label names the row of b in text output, e.g. "builtin [otsu]".
+func (b *solverBench) label() string {
+	return b.Solver + " [" + b.Variant + "]"
+}
+
+// add scores one read of a captcha whose answer is known; an empty read is
+// a failed solve.
+func (b *solverBench) add(answer, read string) {
+	b.Samples++
+	if read != "" {
+		b.Read++
+	}
+	if read == answer {
+		b.Exact++
+	}
+
+	for _, pair := range alignText([]rune(answer), []rune(read)) {
+		if pair.want == 0 {
+			continue // an extra glyph in the read text
+		}
+		b.Chars++
+		if pair.want == pair.got {
+			b.CharsCorrect++
+		}
+
+		for _, group := range confusableGroups {
+			if !strings.ContainsRune(group, pair.want) {
+				continue
+			}
+			column := confusionOther
+			switch {
+			case pair.got == 0:
+				column = confusionMissing
+			case strings.ContainsRune(group, pair.got):
+				column = string(pair.got)
+			}
+			name := groupName(group)
+			if b.Confusion[name] == nil {
+				b.Confusion[name] = make(map[string]map[string]int)
+			}
+			if b.Confusion[name][string(pair.want)] == nil {
+				b.Confusion[name][string(pair.want)] = make(map[string]int)
+			}
+			b.Confusion[name][string(pair.want)][column]++
+		}
+	}
+}
+
+// alignedRune pairs an expected glyph with the one read in its place; a zero
+// want is an extra glyph, a zero got a dropped one.
+type alignedRune struct {
+	want, got rune
+}
+
+// alignText aligns the read text with the answer by edit distance, so one
+// missing or extra glyph does not make the rest of the text count as wrong.
+func alignText(want, got []rune) []alignedRune {
+	// dist[i][j] is the edit distance between want[:i] and got[:j].
+	dist := make([][]int, len(want)+1)
+	for i := range dist {
+		dist[i] = make([]int, len(got)+1)
+		dist[i][0] = i
+	}
+	for j := range dist[0] {
+		dist[0][j] = j
+	}
+	for i := 1; i <= len(want); i++ {
+		for j := 1; j <= len(got); j++ {
+			substitute := dist[i-1][j-1]
+			if want[i-1] != got[j-1] {
+				substitute++
+			}
+			dist[i][j] = min(substitute, dist[i-1][j]+1, dist[i][j-1]+1)
+		}
+	}
+
+	var pairs []alignedRune
+	i, j := len(want), len(got)
+	for i > 0 || j > 0 {
+		switch {
+		case i > 0 && j > 0 && dist[i][j] == dist[i-1][j-1]+boolInt(want[i-1] != got[j-1]):
+			pairs = append(pairs, alignedRune{want[i-1], got[j-1]})
+			i, j = i-1, j-1
+		case i > 0 && dist[i][j] == dist[i-1][j]+1:
+			pairs = append(pairs, alignedRune{want: want[i-1]})
+			i--
+		default:
+			pairs = append(pairs, alignedRune{got: got[j-1]})
+			j--
+		}
+	}
+	for l, r := 0, len(pairs)-1; l < r; l, r = l+1, r-1 {
+		pairs[l], pairs[r] = pairs[r], pairs[l]
+	}
+	return pairs
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// groupName writes a confusable group as "1/l/I".
+func groupName(group string) string {
+	return strings.Join(strings.Split(group, ""), "/")
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// percentile returns the nearest-rank p-th percentile of durations.
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*100) / 100
+}
+
+// writeBenchText prints report as tables.
+func writeBenchText(w io.Writer, report *benchReport) {
+	fmt.Fprintf(w, "%d labelled captchas in %s\n\n", report.Samples, report.Dir)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "solver\tread\texact\tchars\tp50\tp95")
+	for _, bench := range report.Solvers {
+		fmt.Fprintf(tw, "%s\t%d/%d\t%d/%d %.1f%%\t%d/%d %.1f%%\t%.1fms\t%.1fms\n",
+			bench.label(), bench.Read, bench.Samples,
+			bench.Exact, bench.Samples, 100*bench.ExactAccuracy,
+			bench.CharsCorrect, bench.Chars, 100*bench.CharAccuracy,
+			bench.LatencyP50MS, bench.LatencyP95MS)
+	}
+	tw.Flush()
+
+	for _, bench := range report.Solvers {
+		if len(bench.Confusion) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s confusions (rows expected, columns read):\n", bench.label())
+		for _, group := range confusableGroups {
+			matrix := bench.Confusion[groupName(group)]
+			if matrix == nil {
+				continue
+			}
+			columns := append(strings.Split(group, ""), confusionOther, confusionMissing)
+
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+			fmt.Fprintf(tw, "\t%s\t\n", strings.Join(columns, "\t"))
+			for _, want := range strings.Split(group, "") {
+				row := matrix[want]
+				if row == nil {
+					continue
+				}
+				fmt.Fprintf(tw, "%s", want)
+				for _, column := range columns {
+					fmt.Fprintf(tw, "\t%d", row[column])
+				}
+				fmt.Fprintln(tw, "\t")
+			}
+			tw.Flush()
+		}
+	}
+}
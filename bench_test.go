@@ -0,0 +1,187 @@
+package main
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/internal/fakecsgt"
+)
+
+func TestAlignText(t *testing.T) {
+	tests := []struct {
+		want, got string
+		pairs     string // want/got per position, "_" for none
+	}{
+		{"abc", "abc", "aa bb cc"},
+		{"abc", "axc", "aa bx cc"},
+		{"abc", "ac", "aa b_ cc"},
+		{"abc", "abxc", "aa bb _x cc"},
+		{"abc", "", "a_ b_ c_"},
+		{"", "ab", "_a _b"},
+	}
+	for _, tt := range tests {
+		var pairs []string
+		for _, pair := range alignText([]rune(tt.want), []rune(tt.got)) {
+			s := ""
+			for _, r := range []rune{pair.want, pair.got} {
+				if r == 0 {
+					r = '_'
+				}
+				s += string(r)
+			}
+			pairs = append(pairs, s)
+		}
+		if got := strings.Join(pairs, " "); got != tt.pairs {
+			t.Errorf("alignText(%q, %q) = %s, want %s", tt.want, tt.got, got, tt.pairs)
+		}
+	}
+}
+
+func TestSolverBenchAdd(t *testing.T) {
+	b := newSolverBench("tesseract", "default")
+	b.add("5O1abc", "5O1abc")
+	b.add("5O1abc", "S01ab") // 5 read as S, O as 0, c dropped
+	b.add("5O1abc", "")      // failed
+
+	if b.Samples != 3 || b.Read != 2 || b.Exact != 1 {
+		t.Errorf("samples %d, read %d, exact %d; want 3, 2, 1", b.Samples, b.Read, b.Exact)
+	}
+	if b.Chars != 18 || b.CharsCorrect != 9 {
+		t.Errorf("%d/%d characters correct, want 9/18", b.CharsCorrect, b.Chars)
+	}
+	for _, tt := range []struct {
+		group, want, column string
+		count               int
+	}{
+		{"5/S", "5", "5", 1},
+		{"5/S", "5", "S", 1},
+		{"5/S", "5", confusionMissing, 1},
+		{"0/O", "O", "O", 1},
+		{"0/O", "O", "0", 1},
+		{"1/l/I", "1", "1", 2},
+	} {
+		if got := b.Confusion[tt.group][tt.want][tt.column]; got != tt.count {
+			t.Errorf("%s: %s read as %s %d times, want %d", tt.group, tt.want, tt.column, got, tt.count)
+		}
+	}
+	if _, ok := b.Confusion["5/S"]["S"]; ok {
+		t.Error("a glyph never expected got a confusion row")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var durations []time.Duration
+	for i := 10; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	if got := percentile(durations, 0.5); got != 5*time.Millisecond {
+		t.Errorf("p50 = %v, want 5ms", got)
+	}
+	if got := percentile(durations, 0.95); got != 10*time.Millisecond {
+		t.Errorf("p95 = %v, want 10ms", got)
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("p50 of nothing = %v, want 0", got)
+	}
+	if durations[0] != 10*time.Millisecond {
+		t.Error("percentile sorted its argument")
+	}
+}
+
+// writeBenchCaptchas renders captchas as the fake server does into dir,
+// named by their answers.
+func writeBenchCaptchas(t *testing.T, dir string, answers ...string) {
+	t.Helper()
+	for _, answer := range answers {
+		f, err := os.Create(filepath.Join(dir, answer+".png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = png.Encode(f, fakecsgt.RenderCaptcha(answer))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBenchSolver(t *testing.T) {
+	dir := t.TempDir()
+	writeBenchCaptchas(t, dir, "abcdef", "k7mxpa", "234567")
+	samples, err := loadBenchSamples(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 3 || samples[0].answer != "234567" {
+		t.Fatalf("loaded %d samples, want 3 in name order", len(samples))
+	}
+
+	var pipelines []csgt.Pipeline
+	for _, entry := range [][2]string{{"default", csgt.DefaultPreprocessing}, {"plain", "grayscale"}} {
+		pipeline, err := csgt.ParsePipeline(entry[0], entry[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		pipelines = append(pipelines, pipeline)
+	}
+	solver, err := csgt.NewGlyphSolver("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	benches := benchSolver(solver, pipelines, csgt.VoteMajority, samples)
+	if len(benches) != 3 || benches[2].Variant != "majority vote" {
+		t.Fatalf("got %d rows, want one per pipeline and the vote", len(benches))
+	}
+	for _, b := range benches {
+		if b.Samples != 3 || b.Exact != 3 || b.ExactAccuracy != 1 || b.CharAccuracy != 1 || b.LatencyP95MS < b.LatencyP50MS {
+			t.Errorf("%s: %+v, want every captcha read", b.label(), b)
+		}
+	}
+
+	var out strings.Builder
+	writeBenchText(&out, &benchReport{Dir: dir, Samples: len(samples), Solvers: benches})
+	for _, want := range []string{"3 labelled captchas in " + dir, "builtin [default]", "builtin [majority vote]", "3/3 100.0%", "18/18 100.0%"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestLoadBenchSamplesRejectsGarbledImages(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "abcdef.png"), []byte("not a png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadBenchSamples(dir); err == nil {
+		t.Error("a garbled image was loaded")
+	}
+}
+
+func TestWriteBenchTextConfusions(t *testing.T) {
+	b := newSolverBench("tesseract", "default")
+	b.add("5S", "SS")
+	var out strings.Builder
+	writeBenchText(&out, &benchReport{Dir: "dataset", Samples: 1, Solvers: []*solverBench{b}})
+	if !strings.Contains(out.String(), "tesseract [default] confusions (rows expected, columns read):") {
+		t.Fatalf("no confusion matrix:\n%s", out.String())
+	}
+	// Row 5: once read as S; row S: once read as S.
+	lines := strings.Split(out.String(), "\n")
+	var rows []string
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) == 5 && (fields[0] == "5" || fields[0] == "S") {
+			rows = append(rows, strings.Join(fields, " "))
+		}
+	}
+	if strings.Join(rows, "|") != "5 0 1 0 0|S 0 1 0 0" {
+		t.Errorf("confusion rows = %q", rows)
+	}
+}
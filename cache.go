@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"LicensePlatecheck/csgt"
+)
+
+// lookupFunc performs an upstream lookup; checkLicensePlate satisfies it.
+type lookupFunc func(ctx context.Context, licensePlate, vehicleType string) (*csgt.SubmitFormResponse, int, error)
+
+// lookupOutcome is a lookup result together with where it came from.
+type lookupOutcome struct {
+	Result   *csgt.SubmitFormResponse
+	Attempts int
+	Cached   bool
+	Age      time.Duration
+}
+
+type cacheEntry struct {
+	result    *csgt.SubmitFormResponse
+	storedAt  time.Time
+	expiresAt time.Time
+}
+
+// inflightLookup is an upstream lookup shared by every caller asking for the
+// same key while it runs.
+type inflightLookup struct {
+	started chan struct{} // closed once the lookup has its global rate limit token
+	done    chan struct{}
+	cancel  context.CancelFunc
+	callers []*lookupCaller
+	attempt int // latest attempt started
+
+	result   *csgt.SubmitFormResponse
+	attempts int
+	err      error
+}
+
+// lookupCaller is what one caller brings to a shared lookup. The lookup runs
+// on a context of its own, so that it neither ends with nor takes the values
+// of whichever caller started it; these travel beside it instead.
+type lookupCaller struct {
+	apiKey     *APIKey
+	watch      bool
+	onAttempt  func(attempt int)
+	waitBudget time.Duration
+	hasBudget  bool
+}
+
+func newLookupCaller(ctx context.Context) *lookupCaller {
+	caller := &lookupCaller{
+		apiKey:    apiKeyFrom(ctx),
+		watch:     isWatchCheck(ctx),
+		onAttempt: csgt.AttemptCallback(ctx),
+	}
+	caller.waitBudget, caller.hasBudget = waitBudgetFrom(ctx)
+	return caller
+}
+
+// LookupCache caches lookup results per plate and vehicle type and makes
+// concurrent callers for the same key share one upstream lookup.
+type LookupCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	limiter     *RateLimiter
+
+	mu        sync.Mutex
+	entries   map[string]*cacheEntry
+	inflight  map[string]*inflightLookup
+	lastPrune time.Time
+}
+
+// NewLookupCache creates a cache keeping results with violations for ttl and
+// results without violations for negativeTTL. A zero TTL disables caching of
+// that kind of result; in-flight deduplication always applies. Every upstream
+// lookup first takes a token from limiter, unless it is nil.
+func NewLookupCache(ttl, negativeTTL time.Duration, limiter *RateLimiter) *LookupCache {
+	return &LookupCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		limiter:     limiter,
+		entries:     make(map[string]*cacheEntry),
+		inflight:    make(map[string]*inflightLookup),
+		lastPrune:   time.Now(),
+	}
+}
+
+// cacheKey expects the compact plate form, so "98B3-785.78" and "98b378578"
+// share a key once normalized by the plate package.
+func cacheKey(licensePlate, vehicleType string) string {
+	return licensePlate + "|" + strings.TrimSpace(vehicleType)
+}
+
+// Lookup returns a fresh cached result for the key when there is one, and
+// otherwise runs fetch, joining a lookup already in flight for the same key.
+// forceRefresh skips the cached result but still stores the new one. A cached
+// result reports no attempts, since answering it cost none; when the upstream
+// lookup fails the outcome still carries the attempts it used.
+//
+// A shared lookup is cancelled only once every caller has gone away. Each
+// caller keeps its own wait budget for the global rate limit token and hears
+// of every attempt through its own attempt callback; upstream costs are
+// charged to the API key of the caller that started the lookup.
+func (c *LookupCache) Lookup(ctx context.Context, licensePlate, vehicleType string, forceRefresh bool, fetch lookupFunc) (*lookupOutcome, error) {
+	key := cacheKey(licensePlate, vehicleType)
+	now := time.Now()
+	caller := newLookupCaller(ctx)
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		} else if !forceRefresh {
+			c.mu.Unlock()
+			return &lookupOutcome{
+				Result: entry.result,
+				Cached: true,
+				Age:    now.Sub(entry.storedAt),
+			}, nil
+		}
+	}
+
+	call, ok := c.inflight[key]
+	if !ok {
+		call = &inflightLookup{started: make(chan struct{}), done: make(chan struct{})}
+		c.inflight[key] = call
+		go c.run(c.lookupContext(call, caller), key, call, licensePlate, vehicleType, fetch)
+	}
+	call.callers = append(call.callers, caller)
+	attempt := call.attempt
+	c.mu.Unlock()
+
+	if attempt > 0 && caller.onAttempt != nil {
+		caller.onAttempt(attempt)
+	}
+
+	started := call.started
+	var budget <-chan time.Time
+	if caller.hasBudget {
+		timer := time.NewTimer(caller.waitBudget)
+		defer timer.Stop()
+		budget = timer.C
+	}
+	for {
+		select {
+		case <-call.done:
+			if call.err != nil {
+				return &lookupOutcome{Attempts: call.attempts}, call.err
+			}
+			return &lookupOutcome{Result: call.result, Attempts: call.attempts}, nil
+		case <-started:
+			started, budget = nil, nil
+		case <-budget:
+			select {
+			case <-started:
+				started, budget = nil, nil
+				continue
+			default:
+			}
+			c.leave(key, call, caller)
+			rateLimitRejections.WithLabelValues("global").Inc()
+			return nil, &rateLimitError{name: "global", limiter: c.limiter}
+		case <-ctx.Done():
+			c.leave(key, call, caller)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// lookupContext builds the context a shared lookup runs on from the caller
+// starting it. It must be called with c.mu held.
+func (c *LookupCache) lookupContext(call *inflightLookup, caller *lookupCaller) context.Context {
+	ctx := context.Background()
+	if caller.apiKey != nil {
+		ctx = withAPIKey(ctx, caller.apiKey)
+	}
+	if caller.watch {
+		ctx = withWatchCheck(ctx)
+	}
+	ctx = csgt.WithAttemptCallback(ctx, func(attempt int) {
+		c.attempted(call, attempt)
+	})
+	ctx, call.cancel = context.WithCancel(ctx)
+	return ctx
+}
+
+// attempted passes an attempt of a shared lookup on to its callers.
+func (c *LookupCache) attempted(call *inflightLookup, attempt int) {
+	c.mu.Lock()
+	call.attempt = attempt
+	callers := slices.Clone(call.callers)
+	c.mu.Unlock()
+
+	for _, caller := range callers {
+		if caller.onAttempt != nil {
+			caller.onAttempt(attempt)
+		}
+	}
+}
+
+// leave takes caller off a shared lookup, cancelling the lookup when no
+// caller is left.
+func (c *LookupCache) leave(key string, call *inflightLookup, caller *lookupCaller) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	call.callers = slices.DeleteFunc(call.callers, func(other *lookupCaller) bool {
+		return other == caller
+	})
+	if len(call.callers) == 0 {
+		call.cancel()
+		if c.inflight[key] == call {
+			delete(c.inflight, key)
+		}
+	}
+}
+
+func (c *LookupCache) run(ctx context.Context, key string, call *inflightLookup, licensePlate, vehicleType string, fetch lookupFunc) {
+	defer call.cancel()
+
+	var (
+		result   *csgt.SubmitFormResponse
+		attempts int
+		err      error
+	)
+	if c.limiter != nil {
+		err = waitForToken(ctx, c.limiter, "global")
+	}
+	close(call.started)
+	if err == nil {
+		result, attempts, err = fetch(ctx, licensePlate, vehicleType)
+	}
+	call.result, call.attempts, call.err = result, attempts, err
+
+	c.mu.Lock()
+	if c.inflight[key] == call {
+		delete(c.inflight, key)
+	}
+	if err == nil {
+		c.store(key, result)
+	}
+	c.mu.Unlock()
+
+	close(call.done)
+}
+
+// store must be called with c.mu held.
+func (c *LookupCache) store(key string, result *csgt.SubmitFormResponse) {
+	if result == nil || !result.Success.Bool() {
+		return
+	}
+
+	ttl := c.ttl
+	if getViolationCount(result.Details) == 0 {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	c.entries[key] = &cacheEntry{
+		result:    result,
+		storedAt:  now,
+		expiresAt: now.Add(ttl),
+	}
+	c.prune(now)
+}
+
+// prune drops expired entries at most once per minute. It must be called
+// with c.mu held.
+func (c *LookupCache) prune(now time.Time) {
+	if now.Sub(c.lastPrune) < time.Minute {
+		return
+	}
+	c.lastPrune = now
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
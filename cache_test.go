@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"LicensePlatecheck/csgt"
+)
+
+// successResult returns a successful lookup result with n violations.
+func successResult(t *testing.T, n int) *csgt.SubmitFormResponse {
+	t.Helper()
+	var result csgt.SubmitFormResponse
+	if err := json.Unmarshal([]byte(`{"success": true}`), &result); err != nil {
+		t.Fatal(err)
+	}
+	result.Details = &csgt.ResultDetails{Violations: make([]csgt.Violation, n)}
+	return &result
+}
+
+// countingFetch returns a lookupFunc answering result after two attempts and
+// counting its calls.
+func countingFetch(result *csgt.SubmitFormResponse, calls *atomic.Int32) lookupFunc {
+	return func(context.Context, string, string) (*csgt.SubmitFormResponse, int, error) {
+		calls.Add(1)
+		return result, 2, nil
+	}
+}
+
+func TestLookupCacheHit(t *testing.T) {
+	cache := NewLookupCache(time.Minute, time.Minute, nil)
+	result := successResult(t, 1)
+	var calls atomic.Int32
+	fetch := countingFetch(result, &calls)
+
+	first, err := cache.Lookup(context.Background(), "98B378578", "2", false, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Cached || first.Attempts != 2 || first.Result != result {
+		t.Errorf("first lookup = %+v, want the fetched result after 2 attempts", first)
+	}
+
+	second, err := cache.Lookup(context.Background(), "98B378578", "2", false, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Cached || second.Attempts != 0 || second.Result != result {
+		t.Errorf("second lookup = %+v, want the cached result with no attempts", second)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("fetch called %d times, want 1", got)
+	}
+
+	if _, err := cache.Lookup(context.Background(), "98B378578", "1", false, fetch); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("fetch called %d times after another vehicle type, want 2", got)
+	}
+}
+
+func TestLookupCacheForceRefresh(t *testing.T) {
+	cache := NewLookupCache(time.Minute, time.Minute, nil)
+	var calls atomic.Int32
+	old := successResult(t, 1)
+	if _, err := cache.Lookup(context.Background(), "98B378578", "2", false, countingFetch(old, &calls)); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh := successResult(t, 2)
+	refreshed, err := cache.Lookup(context.Background(), "98B378578", "2", true, countingFetch(fresh, &calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Cached || refreshed.Result != fresh {
+		t.Errorf("forced lookup = %+v, want the fresh result", refreshed)
+	}
+
+	cached, err := cache.Lookup(context.Background(), "98B378578", "2", false, countingFetch(old, &calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached.Cached || cached.Result != fresh {
+		t.Errorf("lookup after refresh = %+v, want the refreshed result from the cache", cached)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("fetch called %d times, want 2", got)
+	}
+}
+
+func TestLookupCacheNotStored(t *testing.T) {
+	var calls atomic.Int32
+	failed := errors.New("upstream down")
+	tests := []struct {
+		name  string
+		cache *LookupCache
+		fetch lookupFunc
+	}{
+		{"negative TTL disabled", NewLookupCache(time.Minute, 0, nil), countingFetch(successResult(t, 0), &calls)},
+		{"failed lookup", NewLookupCache(time.Minute, time.Minute, nil), func(context.Context, string, string) (*csgt.SubmitFormResponse, int, error) {
+			calls.Add(1)
+			return nil, 9, failed
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			for i := 0; i < 2; i++ {
+				outcome, _ := tt.cache.Lookup(context.Background(), "30A12345", "1", false, tt.fetch)
+				if outcome.Cached {
+					t.Errorf("lookup %d came from the cache", i+1)
+				}
+			}
+			if got := calls.Load(); got != 2 {
+				t.Errorf("fetch called %d times, want 2", got)
+			}
+		})
+	}
+}
+
+func TestLookupCacheSharesInflight(t *testing.T) {
+	cache := NewLookupCache(time.Minute, time.Minute, nil)
+	result := successResult(t, 1)
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fetch := func(context.Context, string, string) (*csgt.SubmitFormResponse, int, error) {
+		calls.Add(1)
+		<-release
+		return result, 3, nil
+	}
+
+	const callers = 5
+	outcomes := make([]*lookupOutcome, callers)
+	var wg sync.WaitGroup
+	for i := range outcomes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outcome, err := cache.Lookup(context.Background(), "98B378578", "2", false, fetch)
+			if err != nil {
+				t.Error(err)
+			}
+			outcomes[i] = outcome
+		}()
+	}
+	waitFor(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		call := cache.inflight[cacheKey("98B378578", "2")]
+		return call != nil && len(call.callers) == callers
+	})
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("fetch called %d times, want 1", got)
+	}
+	for i, outcome := range outcomes {
+		if outcome == nil || outcome.Result != result || outcome.Attempts != 3 || outcome.Cached {
+			t.Errorf("caller %d got %+v, want the shared result after 3 attempts", i, outcome)
+		}
+	}
+}
+
+func TestLookupCacheCancelsWhenCallersLeave(t *testing.T) {
+	cache := NewLookupCache(time.Minute, time.Minute, nil)
+	fetchDone := make(chan error, 1)
+	fetch := func(ctx context.Context, _, _ string) (*csgt.SubmitFormResponse, int, error) {
+		<-ctx.Done()
+		fetchDone <- ctx.Err()
+		return nil, 1, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	errs := make(chan error, 2)
+	for _, ctx := range []context.Context{ctx1, ctx2} {
+		go func() {
+			_, err := cache.Lookup(ctx, "98B378578", "2", false, fetch)
+			errs <- err
+		}()
+	}
+	waitFor(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		call := cache.inflight[cacheKey("98B378578", "2")]
+		return call != nil && len(call.callers) == 2
+	})
+
+	cancel1()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("first caller got %v, want context.Canceled", err)
+	}
+	select {
+	case err := <-fetchDone:
+		t.Fatalf("lookup ended with %v while a caller was still waiting", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel2()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("second caller got %v, want context.Canceled", err)
+	}
+	select {
+	case err := <-fetchDone:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("lookup ended with %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lookup was not cancelled after its last caller left")
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
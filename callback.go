@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+)
+
+var errCallbackAddress = errors.New("callback address is not public")
+
+// loadCallbackAllowedNetworks reads CALLBACK_ALLOWED_NETWORKS, a comma
+// separated list of CIDRs such as "10.0.5.0/24,fd00::/64" that job callbacks
+// may reach even though they are not public.
+func loadCallbackAllowedNetworks() ([]netip.Prefix, error) {
+	value := os.Getenv("CALLBACK_ALLOWED_NETWORKS")
+	if value == "" {
+		return nil, nil
+	}
+	var networks []netip.Prefix
+	for _, field := range strings.Split(value, ",") {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid CALLBACK_ALLOWED_NETWORKS %q: %w", value, err)
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks, nil
+}
+
+// callbackAddressAllowed reports whether a job callback may connect to addr.
+// Loopback, private (RFC 1918 and unique local), link-local (which includes
+// metadata endpoints such as 169.254.169.254), unspecified and multicast
+// addresses are refused unless one of allowed covers them.
+func callbackAddressAllowed(addr netip.Addr, allowed []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return !(addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified())
+}
+
+// checkCallbackURL validates a callback_url when a job is created. Hosts
+// given as addresses are checked here; names are checked once resolved, when
+// the callback is delivered.
+func checkCallbackURL(raw string, allowed []netip.Prefix) error {
+	if err := validateHTTPURL(raw); err != nil {
+		return err
+	}
+	u, _ := url.Parse(raw)
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil && !callbackAddressAllowed(addr, allowed) {
+		return fmt.Errorf("%w: %s", errCallbackAddress, host)
+	}
+	return nil
+}
+
+// newCallbackClient returns the client job callbacks are delivered with. It
+// checks every address it dials, so names that resolve to a refused address,
+// now or after the job was created, and redirects to one fail as well.
+func newCallbackClient(allowed []netip.Prefix) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: callbackTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !callbackAddressAllowed(addrPort.Addr(), allowed) {
+				return fmt.Errorf("%w: %s", errCallbackAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the connection on our behalf, past the check.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: callbackTimeout, Transport: transport}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestCallbackAddressAllowed(t *testing.T) {
+	allowed := []netip.Prefix{netip.MustParsePrefix("10.0.5.0/24")}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"203.0.113.7", true},
+		{"2001:db8::1", true},
+		{"127.0.0.1", false},
+		{"127.9.9.9", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"10.0.5.9", true},
+		{"::ffff:10.0.5.9", true},
+	}
+	for _, tt := range tests {
+		if got := callbackAddressAllowed(netip.MustParseAddr(tt.addr), allowed); got != tt.want {
+			t.Errorf("callbackAddressAllowed(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCallbackURL(t *testing.T) {
+	allowed := []netip.Prefix{netip.MustParsePrefix("10.0.5.0/24")}
+	tests := []struct {
+		url     string
+		refused bool // refused as a non-public address
+		invalid bool
+	}{
+		{url: "https://hooks.example.com/csgt"},
+		{url: "http://203.0.113.7:8080/done"},
+		{url: "http://10.0.5.9/done"},
+		{url: "http://127.0.0.1:8080/done", refused: true},
+		{url: "http://[::1]/done", refused: true},
+		{url: "http://192.168.1.20/done", refused: true},
+		{url: "http://169.254.169.254/latest/meta-data/", refused: true},
+		{url: "http://[fe80::1]/done", refused: true},
+		{url: "ftp://hooks.example.com/csgt", invalid: true},
+		{url: "/relative", invalid: true},
+	}
+	for _, tt := range tests {
+		err := checkCallbackURL(tt.url, allowed)
+		switch {
+		case tt.refused && !errors.Is(err, errCallbackAddress):
+			t.Errorf("checkCallbackURL(%q) = %v, want %v", tt.url, err, errCallbackAddress)
+		case tt.invalid && (err == nil || errors.Is(err, errCallbackAddress)):
+			t.Errorf("checkCallbackURL(%q) = %v, want an invalid URL error", tt.url, err)
+		case !tt.refused && !tt.invalid && err != nil:
+			t.Errorf("checkCallbackURL(%q) = %v, want nil", tt.url, err)
+		}
+	}
+}
+
+// TestCallbackClientRefusesDial checks that addresses are checked again when
+// connecting, which covers names resolving to a refused address and redirects
+// to one.
+func TestCallbackClientRefusesDial(t *testing.T) {
+	var port uint16
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, fmt.Sprintf("http://[::1]:%d/done", port), http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	port = netip.MustParseAddrPort(srv.Listener.Addr().String()).Port()
+	localhost := fmt.Sprintf("http://localhost:%d", port)
+
+	tests := []struct {
+		name    string
+		allowed []netip.Prefix
+		url     string
+		refused bool
+	}{
+		{name: "loopback address", url: srv.URL + "/done", refused: true},
+		{name: "name resolving to loopback", url: localhost + "/done", refused: true},
+		{name: "allowed network", allowed: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}, url: srv.URL + "/done"},
+		{name: "redirect out of the allowed network", allowed: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}, url: srv.URL + "/redirect", refused: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newCallbackClient(tt.allowed).Post(tt.url, "application/json", nil)
+			if tt.refused {
+				if err == nil {
+					resp.Body.Close()
+				}
+				if !errors.Is(err, errCallbackAddress) {
+					t.Errorf("err = %v, want %v", err, errCallbackAddress)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 127.0.0.1, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := trustedProxies
+	trustedProxies = proxies
+	defer func() { trustedProxies = saved }()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct peer", "203.0.113.7:51234", nil, "203.0.113.7"},
+		{"untrusted peer's headers are ignored", "203.0.113.7:51234", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"}, "203.0.113.7"},
+		{"trusted proxy without headers", "10.1.2.3:80", nil, "10.1.2.3"},
+		{"x-forwarded-for", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"spoofed leftmost hop", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		{"all hops trusted", "127.0.0.1:80", map[string]string{"X-Forwarded-For": "10.0.0.5, 10.0.0.6"}, "10.0.0.5"},
+		{"garbled hop ends the chain", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "198.51.100.1, unknown, 10.0.0.6"}, "10.0.0.6"},
+		{"forwarded wins", "10.1.2.3:80", map[string]string{"Forwarded": `for=198.51.100.9;proto=https, for="[2001:db8::1]:443"`, "X-Forwarded-For": "198.51.100.1"}, "2001:db8::1"},
+		{"x-real-ip", "[::1]:8080", map[string]string{"X-Real-IP": "198.51.100.3"}, "198.51.100.3"},
+		{"ipv4-mapped peer", "[::ffff:203.0.113.7]:443", nil, "203.0.113.7"},
+		{"unparseable remote addr", "pipe", nil, "pipe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := getClientIP(r); got != tt.want {
+				t.Errorf("getClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
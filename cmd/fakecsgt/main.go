@@ -0,0 +1,52 @@
+// Command fakecsgt is a stand-in for www.csgt.vn used for offline development.
+//
+// It serves the fake site of internal/fakecsgt: captcha images with known
+// answers, the tracuu_post AJAX call and result pages with the real markup,
+// so the lookup pipeline can be exercised end to end:
+//
+//	go run ./cmd/fakecsgt -addr :8081 -scenario violations
+//	CSGT_BASE_URL=http://localhost:8081/ go run .
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"LicensePlatecheck/internal/fakecsgt"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "listen address")
+	scenario := flag.String("scenario", string(fakecsgt.ScenarioViolations), "default scenario: none, violations, wrong-captcha, slow, malformed-json")
+	plateScenarios := flag.String("plate-scenarios", "", "per-plate overrides, e.g. 98B378578=violations,30A12345=none")
+	captchaAnswer := flag.String("captcha-answer", "", "fixed captcha answer (random when empty)")
+	acceptAnyCaptcha := flag.Bool("accept-any-captcha", false, "accept every captcha text outside the wrong-captcha scenario")
+	wrongCaptchaCount := flag.Int("wrong-captcha-count", 2, "submits rejected per session in the wrong-captcha scenario")
+	delay := flag.Duration("delay", 5*time.Second, "response delay in the slow scenario")
+	flag.Parse()
+
+	defaultScenario, err := fakecsgt.ParseScenario(*scenario)
+	if err != nil {
+		log.Fatal(err)
+	}
+	overrides, err := fakecsgt.ParsePlateScenarios(*plateScenarios)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := fakecsgt.NewServer(fakecsgt.Config{
+		Scenario:          defaultScenario,
+		PlateScenarios:    overrides,
+		CaptchaAnswer:     *captchaAnswer,
+		AcceptAnyCaptcha:  *acceptAnyCaptcha,
+		WrongCaptchaCount: *wrongCaptchaCount,
+		Delay:             *delay,
+	})
+
+	log.Printf("Fake CSGT server listening on %s (scenario: %s)", *addr, defaultScenario)
+	if err := http.ListenAndServe(*addr, srv.Handler()); err != nil {
+		log.Fatalf("Server failed to start: %v", err)
+	}
+}
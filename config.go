@@ -1,19 +1,205 @@
 package main
 
-import "errors"
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"LicensePlatecheck/csgt"
+)
 
 const (
-	ocrApiURL          = "https://api.ocr.space/parse/image"
-	csgtURL            = "https://www.csgt.vn/"
-	captchaURL         = csgtURL + "lib/captcha/captcha.class.php"
-	submitURL          = csgtURL + "?mod=contact&task=tracuu_post&ajax"
-	formURL            = csgtURL + "tra-cuu-phuong-tien-vi-pham.html"
-	maxCaptchaAttempts = 9
+	defaultCaptchaSolvers   = "tesseract,ocrspace"
+	defaultCacheTTL         = 15 * time.Minute
+	defaultNegativeCacheTTL = 5 * time.Minute
+	defaultShutdownTimeout  = 30 * time.Second
+
+	// shutdownGrace is how long cancelled requests get to finish after the
+	// drain timeout before connections are closed.
+	shutdownGrace = 2 * time.Second
+)
+
+// Rate limit modes: "wait" blocks until a token is free, "reject" answers 429
+// once rateLimitWaitBudget has passed without one.
+const (
+	rateLimitModeWait   = "wait"
+	rateLimitModeReject = "reject"
+
+	defaultRateLimitWaitBudget = 2 * time.Second
 )
 
 var (
-	apiKey             string // Loaded from .env
-	defaultIPClient    = "9.9.9.91"
-	userAgent          = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36"
-	errCaptchaMismatch = errors.New("captcha mismatch")
+	rateLimitMode       = rateLimitModeWait
+	rateLimitWaitBudget = defaultRateLimitWaitBudget
 )
+
+// rateLimitContext applies the wait budget to a request context in reject mode.
+func rateLimitContext(ctx context.Context) context.Context {
+	if rateLimitMode == rateLimitModeReject {
+		return withWaitBudget(ctx, rateLimitWaitBudget)
+	}
+	return ctx
+}
+
+// lookupTimeout bounds a single lookup request; zero means no server-side deadline.
+var lookupTimeout time.Duration
+
+// envDuration reads a duration such as "90s" from the environment variable
+// name, falling back to def when it is unset.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	return d, nil
+}
+
+// envInt reads a positive integer from the environment variable name,
+// falling back to def when it is unset.
+func envInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: want a positive integer", name, value)
+	}
+	return n, nil
+}
+
+// validateHTTPURL checks that raw is an absolute http(s) URL.
+func validateHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL", raw)
+	}
+	return nil
+}
+
+// loadCaptchaSolver builds the captcha solver chain from the JSON file named by
+// CAPTCHA_SOLVER_CONFIG, or else from CAPTCHA_SOLVERS (e.g. "tesseract:10s,ocrspace").
+func loadCaptchaSolver(apiKey string) (*csgt.Chain, error) {
+	configs, err := loadSolverConfigs(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return csgt.BuildChain(configs)
+}
+
+// loadSolverConfigs reads the configured solver chain entries.
+func loadSolverConfigs(apiKey string) ([]csgt.SolverConfig, error) {
+	var (
+		configs []csgt.SolverConfig
+		err     error
+	)
+	if path := os.Getenv("CAPTCHA_SOLVER_CONFIG"); path != "" {
+		configs, err = csgt.LoadSolverConfigFile(path)
+	} else {
+		spec := os.Getenv("CAPTCHA_SOLVERS")
+		if spec == "" {
+			spec = defaultCaptchaSolvers
+		}
+		configs, err = csgt.ParseSolverSpec(spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	setOCRSpaceKey(configs, apiKey)
+	return configs, nil
+}
+
+// loadPreprocessing reads the captcha preprocessing pipelines from
+// CAPTCHA_PREPROCESS (e.g. "plain=grayscale,contrast:20; otsu=grayscale,threshold")
+// and how their reads are combined from CAPTCHA_VOTE.
+func loadPreprocessing() ([]csgt.Pipeline, string, error) {
+	return parsePreprocessing(os.Getenv("CAPTCHA_PREPROCESS"), os.Getenv("CAPTCHA_VOTE"))
+}
+
+// parsePreprocessing parses a pipeline spec and vote mode, falling back to
+// the default pipeline and a majority vote.
+func parsePreprocessing(spec, vote string) ([]csgt.Pipeline, string, error) {
+	var pipelines []csgt.Pipeline
+	if spec == "" {
+		pipelines = []csgt.Pipeline{csgt.DefaultPipeline()}
+	} else {
+		var err error
+		if pipelines, err = csgt.ParsePipelines(spec); err != nil {
+			return nil, "", err
+		}
+	}
+	mode, err := csgt.ParseVoteMode(vote)
+	if err != nil {
+		return nil, "", err
+	}
+	return pipelines, mode, nil
+}
+
+// loadCaptchaCheck reads which captcha reads are worth submitting:
+// CAPTCHA_LENGTH ("6" or a range "4-6", csgt.CaptchaLength by default),
+// CAPTCHA_CHARSET, CAPTCHA_MIN_CONFIDENCE (0 to 1) and CAPTCHA_REFRESHES, how
+// many fresh captchas a lookup may download in place of reads that fail.
+func loadCaptchaCheck() (csgt.CaptchaCheck, error) {
+	check := csgt.DefaultCaptchaCheck()
+
+	if value := os.Getenv("CAPTCHA_LENGTH"); value != "" {
+		lo, hi, isRange := strings.Cut(value, "-")
+		if !isRange {
+			hi = lo
+		}
+		minLength, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		maxLength, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || minLength <= 0 || maxLength < minLength {
+			return check, fmt.Errorf("invalid CAPTCHA_LENGTH %q: want a length such as 6 or a range such as 4-6", value)
+		}
+		check.MinLength, check.MaxLength = minLength, maxLength
+	}
+
+	if value := os.Getenv("CAPTCHA_CHARSET"); value != "" {
+		check.Charset = value
+	}
+
+	if value := os.Getenv("CAPTCHA_MIN_CONFIDENCE"); value != "" {
+		confidence, err := strconv.ParseFloat(value, 64)
+		if err != nil || confidence < 0 || confidence > 1 {
+			return check, fmt.Errorf("invalid CAPTCHA_MIN_CONFIDENCE %q: want a number from 0 to 1", value)
+		}
+		check.MinConfidence = confidence
+	}
+
+	if value := os.Getenv("CAPTCHA_REFRESHES"); value != "" {
+		refreshes, err := strconv.Atoi(value)
+		if err != nil || refreshes < 0 {
+			return check, fmt.Errorf("invalid CAPTCHA_REFRESHES %q: want a non-negative integer", value)
+		}
+		check.Refreshes = refreshes
+	}
+	return check, nil
+}
+
+// setOCRSpaceKey gives ocrspace entries the OCR_API_KEY unless the config
+// sets one.
+func setOCRSpaceKey(configs []csgt.SolverConfig, apiKey string) {
+	for i := range configs {
+		if !strings.EqualFold(configs[i].Name, "ocrspace") {
+			continue
+		}
+		if configs[i].Options == nil {
+			configs[i].Options = make(map[string]string)
+		}
+		if configs[i].Options["api_key"] == "" {
+			configs[i].Options["api_key"] = apiKey
+		}
+	}
+}
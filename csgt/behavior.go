@@ -0,0 +1,71 @@
+package csgt
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BehaviorCode is the decree reference CSGT prefixes to a violation behavior,
+// e.g. "16824.7.2.b.01" for Decree 168/2024, Article 7, Clause 2, Point b.
+type BehaviorCode struct {
+	Code        string `json:"code"`
+	Decree      string `json:"decree"`
+	Article     int    `json:"article"`
+	Clause      int    `json:"clause"`
+	Point       string `json:"point,omitempty"`
+	Variant     string `json:"variant,omitempty"`
+	Description string `json:"description"`
+}
+
+// behaviorPattern matches "<decree><yy>.<article>.<clause>[.<point>][.<variant>].<description>".
+var behaviorPattern = regexp.MustCompile(`^(\d{3,6})\.(\d{1,3})\.(\d{1,3})(?:\.([a-zđ]{1,2}))?(?:\.(\d{1,3}))?\.\s*(.+)$`)
+
+// ParseBehavior splits a behavior string into its decree reference and the
+// clean description.
+func ParseBehavior(s string) (*BehaviorCode, error) {
+	s = strings.TrimSpace(s)
+	m := behaviorPattern.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("behavior %q has no decree code", s)
+	}
+
+	decree := m[1]
+	article, _ := strconv.Atoi(m[2])
+	clause, _ := strconv.Atoi(m[3])
+
+	code := strings.Join([]string{decree, m[2], m[3]}, ".")
+	if m[4] != "" {
+		code += "." + m[4]
+	}
+	if m[5] != "" {
+		code += "." + m[5]
+	}
+
+	return &BehaviorCode{
+		Code:        code,
+		Decree:      decree[:len(decree)-2] + "/20" + decree[len(decree)-2:],
+		Article:     article,
+		Clause:      clause,
+		Point:       m[4],
+		Variant:     m[5],
+		Description: strings.TrimSpace(m[6]),
+	}, nil
+}
+
+// parseBehaviors decodes the behavior code of each violation and attaches the
+// fine from the embedded table when the code is known.
+func parseBehaviors(violations []Violation) {
+	for i := range violations {
+		v := &violations[i]
+		code, err := ParseBehavior(v.Behavior)
+		if err != nil {
+			continue
+		}
+		v.BehaviorCode = code
+		if fine, ok := LookupFine(code); ok {
+			v.Fine = &fine
+		}
+	}
+}
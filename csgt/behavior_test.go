@@ -0,0 +1,57 @@
+package csgt
+
+import "testing"
+
+func TestParseBehavior(t *testing.T) {
+	tests := []struct {
+		in   string
+		want BehaviorCode
+	}{
+		{
+			"16824.7.2.b.01.Điều khiển xe chạy quá tốc độ quy định từ 05 km/h đến dưới 10 km/h",
+			BehaviorCode{
+				Code:        "16824.7.2.b.01",
+				Decree:      "168/2024",
+				Article:     7,
+				Clause:      2,
+				Point:       "b",
+				Variant:     "01",
+				Description: "Điều khiển xe chạy quá tốc độ quy định từ 05 km/h đến dưới 10 km/h",
+			},
+		},
+		{
+			"  16824.6.5.đ. Chạy quá tốc độ ",
+			BehaviorCode{Code: "16824.6.5.đ", Decree: "168/2024", Article: 6, Clause: 5, Point: "đ", Description: "Chạy quá tốc độ"},
+		},
+		{
+			"10019.5.1.Không chấp hành hiệu lệnh",
+			BehaviorCode{Code: "10019.5.1", Decree: "100/2019", Article: 5, Clause: 1, Description: "Không chấp hành hiệu lệnh"},
+		},
+		{
+			"10019.5.1.03.Dừng xe sai quy định",
+			BehaviorCode{Code: "10019.5.1.03", Decree: "100/2019", Article: 5, Clause: 1, Variant: "03", Description: "Dừng xe sai quy định"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseBehavior(tt.in)
+		if err != nil {
+			t.Errorf("ParseBehavior(%q): %v", tt.in, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("ParseBehavior(%q) = %+v, want %+v", tt.in, *got, tt.want)
+		}
+	}
+}
+
+func TestParseBehaviorWithoutCode(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"Điều khiển xe chạy quá tốc độ",
+		"16824.7.Điều khiển xe",
+	} {
+		if got, err := ParseBehavior(in); err == nil {
+			t.Errorf("ParseBehavior(%q) = %+v, want an error", in, *got)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package csgt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// CaptchaLength is the number of characters in every csgt.vn captcha.
+	CaptchaLength = 6
+
+	// DefaultCaptchaCharset is every character a captcha may contain unless
+	// configured otherwise: ASCII letters and digits.
+	DefaultCaptchaCharset = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	// DefaultMinConfidence is the lowest solver confidence worth a submit.
+	DefaultMinConfidence = 0.5
+
+	// DefaultCaptchaRefreshes is how many fresh captchas a lookup may
+	// download in place of reads that fail the CaptchaCheck.
+	DefaultCaptchaRefreshes = 3
+)
+
+var (
+	// ErrLowConfidence marks a read its solver was not sure enough of.
+	ErrLowConfidence = errors.New("low confidence")
+
+	// ErrMalformedCaptcha marks a read that cannot be the answer because of
+	// its length or characters.
+	ErrMalformedCaptcha = errors.New("malformed captcha text")
+
+	// ErrCaptchaUnreadable ends an attempt whose refreshes are used up on a
+	// malformed read, which would be wasted on a submit. The lookup goes on
+	// with a fresh session until its attempts run out.
+	ErrCaptchaUnreadable = errors.New("captcha unreadable")
+)
+
+// Reasons a read is skipped, as reported to SkipObserver.CaptchaSkipped.
+const (
+	SkipLowConfidence = "low_confidence"
+	SkipMalformed     = "malformed"
+)
+
+// CaptchaCheck decides whether a captcha read is worth submitting. Reads
+// that fail it are replaced by a fresh captcha from the same session.
+type CaptchaCheck struct {
+	MinLength     int     // 0 leaves the minimum unchecked
+	MaxLength     int     // 0 leaves the maximum unchecked
+	Charset       string  // characters a captcha may contain; empty allows any
+	MinConfidence float64 // 0 accepts every confidence
+
+	// Refreshes is how many fresh captchas one lookup may download. They
+	// are counted apart from the attempts, which are submits.
+	Refreshes int
+}
+
+// DefaultCaptchaCheck allows CaptchaLength letters and digits read with at
+// least DefaultMinConfidence.
+func DefaultCaptchaCheck() CaptchaCheck {
+	return CaptchaCheck{
+		MinLength:     CaptchaLength,
+		MaxLength:     CaptchaLength,
+		Charset:       DefaultCaptchaCharset,
+		MinConfidence: DefaultMinConfidence,
+		Refreshes:     DefaultCaptchaRefreshes,
+	}
+}
+
+// WithCaptchaCheck replaces DefaultCaptchaCheck.
+func WithCaptchaCheck(check CaptchaCheck) Option {
+	return func(c *Client) {
+		c.check = check
+	}
+}
+
+// Check returns an error wrapping ErrMalformedCaptcha or ErrLowConfidence
+// when read should not be submitted.
+func (c CaptchaCheck) Check(read Read) error {
+	length := utf8.RuneCountInString(read.Text)
+	if c.MinLength > 0 && length < c.MinLength {
+		return fmt.Errorf("%w: %q is shorter than %d characters", ErrMalformedCaptcha, read.Text, c.MinLength)
+	}
+	if c.MaxLength > 0 && length > c.MaxLength {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrMalformedCaptcha, read.Text, c.MaxLength)
+	}
+	if c.Charset != "" {
+		for _, r := range read.Text {
+			if !strings.ContainsRune(c.Charset, r) {
+				return fmt.Errorf("%w: %q contains %q", ErrMalformedCaptcha, read.Text, r)
+			}
+		}
+	}
+	if read.Confidence < c.MinConfidence {
+		return fmt.Errorf("%w: %q read by %s with confidence %.2f", ErrLowConfidence, read.Text, read.Solver, read.Confidence)
+	}
+	return nil
+}
+
+// readCaptcha solves captchas in the session until one passes the check,
+// downloading a fresh one for each read that does not instead of wasting a
+// submit on it. refreshes counts the fresh captchas the lookup has used.
+// Once they reach the budget a low-confidence read is submitted anyway,
+// since it may still be right; a malformed one cannot be and ends the attempt
+// with ErrCaptchaUnreadable.
+func (c *Client) readCaptcha(ctx context.Context, client *http.Client, refreshes *int) (*solvedCaptcha, error) {
+	for {
+		captcha, err := c.solveCaptcha(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		err = c.check.Check(captcha.Read)
+		if err == nil {
+			return captcha, nil
+		}
+
+		if *refreshes >= c.check.Refreshes {
+			if errors.Is(err, ErrLowConfidence) {
+				log.Printf("Submitting captcha despite %v: no refreshes left", err)
+				return captcha, nil
+			}
+			return nil, fmt.Errorf("%w after %d refreshes: %v", ErrCaptchaUnreadable, *refreshes, err)
+		}
+		reason := SkipMalformed
+		if errors.Is(err, ErrLowConfidence) {
+			reason = SkipLowConfidence
+		}
+		*refreshes++
+		if o, ok := c.observer.(SkipObserver); ok {
+			o.CaptchaSkipped(ctx, reason)
+		}
+		log.Printf("Skipping captcha read (%v), downloading a fresh one", err)
+	}
+}
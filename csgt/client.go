@@ -0,0 +1,201 @@
+package csgt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client looks up traffic violations on the CSGT website.
+type Client struct {
+	baseURL       string
+	httpClient    *http.Client
+	solver        CaptchaSolver
+	ocrAPIKey     string
+	maxAttempts   int
+	resultRetries int
+	observer      Observer
+	recorder      CaptchaRecorder
+	pipelines     []Pipeline
+	vote          string
+	check         CaptchaCheck
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithBaseURL points the client at another CSGT-compatible server.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		if !strings.HasSuffix(baseURL, "/") {
+			baseURL += "/"
+		}
+		c.baseURL = baseURL
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for upstream requests. Every
+// attempt runs on a copy of it with its own cookie jar.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// WithSolver replaces the default Tesseract + OCR.space captcha solver chain.
+func WithSolver(solver CaptchaSolver) Option {
+	return func(c *Client) {
+		c.solver = solver
+	}
+}
+
+// WithOCRSpaceKey sets the OCR.space API key used by the default solver.
+func WithOCRSpaceKey(key string) Option {
+	return func(c *Client) {
+		c.ocrAPIKey = key
+	}
+}
+
+// WithMaxAttempts limits how many captcha/submit cycles a lookup may use.
+func WithMaxAttempts(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.maxAttempts = n
+		}
+	}
+}
+
+// WithResultRetries limits how many times the result page is fetched.
+func WithResultRetries(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.resultRetries = n
+		}
+	}
+}
+
+// NewClient creates a Client with the given options applied over the defaults.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		baseURL:       DefaultBaseURL,
+		maxAttempts:   DefaultMaxAttempts,
+		resultRetries: DefaultResultRetries,
+		check:         DefaultCaptchaCheck(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		c.httpClient = defaultHTTPClient()
+	}
+	if c.observer == nil {
+		c.observer = NopObserver{}
+	}
+	if len(c.pipelines) == 0 {
+		c.pipelines = []Pipeline{DefaultPipeline()}
+	}
+	if c.vote == "" {
+		c.vote = VoteMajority
+	}
+	if c.solver == nil {
+		c.solver = NewChain(
+			&TesseractSolver{},
+			&OCRSpaceSolver{APIKey: c.ocrAPIKey},
+		)
+	}
+	return c
+}
+
+func defaultHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: defaultHTTPTimeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 100,
+			IdleConnTimeout:     90 * time.Second,
+			DisableKeepAlives:   false,
+		},
+	}
+}
+
+func (c *Client) captchaURL() string {
+	return c.baseURL + captchaPath
+}
+
+func (c *Client) submitURL() string {
+	return c.baseURL + submitPath
+}
+
+func (c *Client) formURL() string {
+	return c.baseURL + formPath
+}
+
+type attemptCallbackKey struct{}
+
+// WithAttemptCallback returns a copy of ctx that makes Lookup call fn with the
+// number of each captcha/submit attempt as it starts.
+func WithAttemptCallback(ctx context.Context, fn func(attempt int)) context.Context {
+	return context.WithValue(ctx, attemptCallbackKey{}, fn)
+}
+
+// AttemptCallback returns the function WithAttemptCallback put in ctx, or nil.
+func AttemptCallback(ctx context.Context) func(attempt int) {
+	fn, _ := ctx.Value(attemptCallbackKey{}).(func(int))
+	return fn
+}
+
+// Lookup checks licensePlate for violations, retrying with a fresh captcha
+// whenever the upstream rejects it. It returns the parsed response and the
+// number of attempts used.
+func (c *Client) Lookup(ctx context.Context, licensePlate, vehicleType string) (*SubmitFormResponse, int, error) {
+	ctx = withObserver(ctx, c.observer)
+	result, attempts, err := c.lookup(ctx, licensePlate, vehicleType)
+	c.observer.LookupFinished(ctx, result, attempts, err)
+	return result, attempts, err
+}
+
+func (c *Client) lookup(ctx context.Context, licensePlate, vehicleType string) (*SubmitFormResponse, int, error) {
+	var lastErr error
+	refreshes := 0
+	// unreadable counts the attempts that ended without a submit; the
+	// attempts reported are the submits.
+	unreadable := 0
+	for attempt := 1; attempt <= c.maxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, attempt - 1 - unreadable, err
+		}
+		if onAttempt := AttemptCallback(ctx); onAttempt != nil {
+			onAttempt(attempt - unreadable)
+		}
+
+		result, err := c.performSingleAttempt(ctx, licensePlate, vehicleType, &refreshes)
+		if err == nil {
+			result.CaptchaRefreshes = refreshes
+			return result, attempt - unreadable, nil
+		}
+		if errors.Is(err, ErrCaptchaMismatch) {
+			lastErr = err
+			continue
+		}
+		if errors.Is(err, ErrCaptchaUnreadable) {
+			// Nothing was submitted; the next attempt starts a fresh session.
+			unreadable++
+			lastErr = err
+			continue
+		}
+		return nil, attempt - unreadable, err
+	}
+
+	attempts := c.maxAttempts - unreadable
+	if errors.Is(lastErr, ErrCaptchaUnreadable) {
+		return nil, attempts, fmt.Errorf("no readable captcha after %d attempts: %w", c.maxAttempts, lastErr)
+	}
+	if lastErr != nil {
+		return nil, attempts, fmt.Errorf("captcha validation failed after %d attempts", c.maxAttempts)
+	}
+
+	return nil, attempts, fmt.Errorf("failed to check license plate after %d attempts", c.maxAttempts)
+}
@@ -0,0 +1,138 @@
+package csgt
+
+import (
+	"context"
+	"errors"
+	"image"
+	"net/http/httptest"
+	"testing"
+
+	"LicensePlatecheck/internal/fakecsgt"
+)
+
+// fixedAnswer is the answer of every captcha the fake server serves in tests.
+const fixedAnswer = "k7mxpa"
+
+// answerSolver reads the captchas as texts in turn, the last one over and
+// over.
+func answerSolver(texts ...string) CaptchaSolver {
+	n := 0
+	return SolverFunc(func(context.Context, image.Image) (string, error) {
+		text := texts[min(n, len(texts)-1)]
+		n++
+		return text, nil
+	})
+}
+
+func TestClientLookup(t *testing.T) {
+	tests := []struct {
+		name       string
+		scenario   fakecsgt.Scenario
+		wrong      int      // submits rejected in the wrong-captcha scenario
+		reads      []string // what the solver reads, captcha by captcha
+		attempts   int
+		refreshes  int
+		violations int
+		err        error // wrapped by the lookup error; nil for any error
+		fails      bool
+	}{
+		{name: "violations", scenario: fakecsgt.ScenarioViolations, reads: []string{fixedAnswer}, attempts: 1, violations: 2},
+		{name: "no violations", scenario: fakecsgt.ScenarioNone, reads: []string{fixedAnswer}, attempts: 1},
+		{name: "answer in other case", scenario: fakecsgt.ScenarioNone, reads: []string{"K7MXPA"}, attempts: 1},
+		{name: "unreadable captcha is refreshed", scenario: fakecsgt.ScenarioNone, reads: []string{"k7m", "k7mxpa!", fixedAnswer}, attempts: 1, refreshes: 2},
+		{name: "rejected captchas are retried", scenario: fakecsgt.ScenarioWrongCaptcha, wrong: 2, reads: []string{fixedAnswer}, attempts: 3, violations: 2},
+		{name: "wrong read every attempt", scenario: fakecsgt.ScenarioNone, reads: []string{"zzzzzz"}, attempts: 3, fails: true},
+		{name: "unreadable captcha moves to a fresh session", scenario: fakecsgt.ScenarioNone, reads: []string{"k7m", "k7m", "k7m", "k7m", fixedAnswer}, attempts: 1, refreshes: 3},
+		{name: "unreadable captcha in every attempt is not submitted", scenario: fakecsgt.ScenarioNone, reads: []string{"k7m"}, attempts: 0, err: ErrCaptchaUnreadable, fails: true},
+		{name: "malformed submit response", scenario: fakecsgt.ScenarioMalformedJSON, reads: []string{fixedAnswer}, attempts: 1, fails: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(fakecsgt.NewServer(fakecsgt.Config{
+				Scenario:          tt.scenario,
+				CaptchaAnswer:     fixedAnswer,
+				WrongCaptchaCount: tt.wrong,
+			}).Handler())
+			defer srv.Close()
+
+			var started []int
+			ctx := WithAttemptCallback(context.Background(), func(attempt int) {
+				started = append(started, attempt)
+			})
+			client := NewClient(
+				WithBaseURL(srv.URL),
+				WithSolver(answerSolver(tt.reads...)),
+				WithMaxAttempts(3),
+			)
+			result, attempts, err := client.lookup(ctx, "98B378578", "2")
+
+			if attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("lookup succeeded with %+v, want an error", result)
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Errorf("error = %v, want one wrapping %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lookup: %v", err)
+			}
+			// Attempts without a submit repeat the number of the next one.
+			if len(started) == 0 || started[len(started)-1] != tt.attempts {
+				t.Errorf("attempt callback saw %v, want %d attempts", started, tt.attempts)
+			}
+			if !result.Success.Bool() {
+				t.Errorf("result not successful: %+v", result)
+			}
+			if result.CaptchaRefreshes != tt.refreshes {
+				t.Errorf("CaptchaRefreshes = %d, want %d", result.CaptchaRefreshes, tt.refreshes)
+			}
+			if result.Details == nil {
+				t.Fatal("result has no details")
+			}
+			if got := len(result.Details.Violations); got != tt.violations {
+				t.Fatalf("got %d violations, want %d", got, tt.violations)
+			}
+			for _, v := range result.Details.Violations {
+				if v.ID == "" || v.ViolatedAt == nil || v.BehaviorCode == nil {
+					t.Errorf("violation not fully parsed: %+v", v)
+				}
+			}
+		})
+	}
+}
+
+// TestClientLookupUnreadableUsesEveryAttempt reads every captcha as
+// malformed text: once the refreshes are used up each attempt gets one fresh
+// session, and nothing is ever submitted.
+func TestClientLookupUnreadableUsesEveryAttempt(t *testing.T) {
+	srv := httptest.NewServer(fakecsgt.NewServer(fakecsgt.Config{
+		Scenario:      fakecsgt.ScenarioNone,
+		CaptchaAnswer: fixedAnswer,
+	}).Handler())
+	defer srv.Close()
+
+	reads := 0
+	client := NewClient(
+		WithBaseURL(srv.URL),
+		WithSolver(SolverFunc(func(context.Context, image.Image) (string, error) {
+			reads++
+			return "k7m!", nil
+		})),
+		WithMaxAttempts(4),
+	)
+	result, attempts, err := client.Lookup(context.Background(), "98B378578", "2")
+	if !errors.Is(err, ErrCaptchaUnreadable) {
+		t.Fatalf("Lookup = %+v, %v; want an error wrapping %v", result, err, ErrCaptchaUnreadable)
+	}
+	if attempts != 0 {
+		t.Errorf("attempts = %d, want 0: nothing was submitted", attempts)
+	}
+	if want := DefaultCaptchaRefreshes + 4; reads != want {
+		t.Errorf("solver read %d captchas, want %d: the refreshes plus one per attempt", reads, want)
+	}
+}
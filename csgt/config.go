@@ -0,0 +1,33 @@
+package csgt
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the public CSGT site queried when no base URL is set.
+	DefaultBaseURL = "https://www.csgt.vn/"
+
+	// DefaultMaxAttempts is how many captcha/submit cycles a lookup may use.
+	DefaultMaxAttempts = 9
+
+	// DefaultResultRetries is how many times the result page is fetched.
+	DefaultResultRetries = 3
+
+	ocrApiURL   = "https://api.ocr.space/parse/image"
+	captchaPath = "lib/captcha/captcha.class.php"
+	submitPath  = "?mod=contact&task=tracuu_post&ajax"
+	formPath    = "tra-cuu-phuong-tien-vi-pham.html"
+
+	defaultHTTPTimeout = 45 * time.Second
+)
+
+var (
+	defaultIPClient = "9.9.9.91"
+	userAgent       = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36"
+
+	// ErrCaptchaMismatch is returned by a single attempt when the upstream
+	// rejects the submitted captcha text.
+	ErrCaptchaMismatch = errors.New("captcha mismatch")
+)
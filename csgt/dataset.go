@@ -0,0 +1,215 @@
+package csgt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Dataset labels.
+const (
+	LabelVerified = "verified" // the upstream accepted the answer
+	LabelRejected = "rejected" // the upstream answered 404, the answer was wrong
+)
+
+// CaptchaSample is one captcha whose answer was submitted, labelled by what
+// the upstream made of it.
+type CaptchaSample struct {
+	Image      []byte // raw bytes as downloaded, before preprocessing
+	Text       string // the answer that was submitted
+	Solver     string // the solver that produced Text
+	Variant    string // the preprocessing pipeline Text was read from
+	Verified   bool
+	CapturedAt time.Time
+}
+
+// CaptchaRecorder receives every submitted captcha once the submit outcome
+// is known. Submits that fail for other reasons than the answer, such as
+// network errors, are not recorded. RecordCaptcha is called synchronously on
+// the lookup goroutine.
+type CaptchaRecorder interface {
+	RecordCaptcha(ctx context.Context, sample CaptchaSample)
+}
+
+// WithCaptchaRecorder makes the client hand every submitted captcha to r.
+func WithCaptchaRecorder(r CaptchaRecorder) Option {
+	return func(c *Client) {
+		c.recorder = r
+	}
+}
+
+// DatasetRecord is the metadata stored next to each captcha image.
+type DatasetRecord struct {
+	ID      string `json:"id"`
+	Image   string `json:"image"`
+	Text    string `json:"text"`
+	Solver  string `json:"solver"`
+	Variant string `json:"variant,omitempty"`
+	Label   string `json:"label"`
+	// Answer is the known correct text: the submitted text for verified
+	// captchas, empty for rejected ones until someone fills it in by hand.
+	Answer     string    `json:"answer"`
+	CapturedAt time.Time `json:"captured_at"`
+}
+
+// Dataset stores captcha samples in a directory laid out as
+//
+//	<dir>/verified/<id>.png   captcha image as downloaded
+//	<dir>/verified/<id>.json  DatasetRecord
+//	<dir>/rejected/<id>.png
+//	<dir>/rejected/<id>.json
+//
+// where the image extension follows the downloaded content and <id> starts
+// with the capture time, so names sort chronologically. The JSON file is
+// written last; an image without one is an interrupted write.
+type Dataset struct {
+	dir string
+}
+
+// NewDataset stores samples under dir, creating it when needed.
+func NewDataset(dir string) (*Dataset, error) {
+	for _, label := range []string{LabelVerified, LabelRejected} {
+		if err := os.MkdirAll(filepath.Join(dir, label), 0o755); err != nil {
+			return nil, fmt.Errorf("error creating dataset directory: %w", err)
+		}
+	}
+	return &Dataset{dir: dir}, nil
+}
+
+// RecordCaptcha implements CaptchaRecorder. Errors are logged; a full disk
+// must not fail lookups.
+func (d *Dataset) RecordCaptcha(ctx context.Context, sample CaptchaSample) {
+	if _, err := d.Save(sample); err != nil {
+		log.Printf("warning: unable to save captcha sample: %v", err)
+	}
+}
+
+// Save writes sample and returns its record.
+func (d *Dataset) Save(sample CaptchaSample) (*DatasetRecord, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("error generating sample id: %w", err)
+	}
+	capturedAt := sample.CapturedAt
+	if capturedAt.IsZero() {
+		capturedAt = time.Now()
+	}
+	id := capturedAt.UTC().Format("20060102T150405.000Z") + "-" + hex.EncodeToString(suffix)
+
+	record := &DatasetRecord{
+		ID:         id,
+		Image:      id + imageExtension(sample.Image),
+		Text:       sample.Text,
+		Solver:     sample.Solver,
+		Variant:    sample.Variant,
+		Label:      LabelRejected,
+		CapturedAt: capturedAt,
+	}
+	if sample.Verified {
+		record.Label = LabelVerified
+		record.Answer = sample.Text
+	}
+
+	dir := filepath.Join(d.dir, record.Label)
+	if err := os.WriteFile(filepath.Join(dir, record.Image), sample.Image, 0o644); err != nil {
+		return nil, fmt.Errorf("error writing captcha image: %w", err)
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding captcha record: %w", err)
+	}
+	path := filepath.Join(dir, id+".json")
+	if err := os.WriteFile(path+".tmp", append(data, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("error writing captcha record: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return nil, fmt.Errorf("error writing captcha record: %w", err)
+	}
+	return record, nil
+}
+
+// imageExtension picks a file extension from the image content.
+func imageExtension(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/bmp":
+		return ".bmp"
+	default:
+		return ".bin"
+	}
+}
+
+// LabeledCaptcha is a captcha image with its known answer.
+type LabeledCaptcha struct {
+	Path   string
+	Answer string
+}
+
+// datasetIDPattern matches the file names Dataset gives its samples.
+var datasetIDPattern = regexp.MustCompile(`^\d{8}T\d{6}\.\d{3}Z-[0-9a-f]{8}$`)
+
+// ReadLabeledCaptchas walks dir for captcha images with a known answer. The
+// answer is taken from the DatasetRecord next to the image when there is one,
+// otherwise from the file name up to the first "_", so hand-labelled images
+// can be named "k7mxp.png" or "k7mxp_2.png". Dataset samples without an
+// answer, such as unlabelled rejected captchas, are skipped. Images are
+// returned in lexical path order.
+func ReadLabeledCaptchas(dir string) ([]LabeledCaptcha, error) {
+	var captchas []LabeledCaptcha
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if entry.IsDir() || !isImageExtension(ext) {
+			return nil
+		}
+		stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+		data, err := os.ReadFile(strings.TrimSuffix(path, filepath.Ext(path)) + ".json")
+		switch {
+		case err == nil:
+			var record DatasetRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return fmt.Errorf("error parsing record of %s: %w", path, err)
+			}
+			if record.Answer != "" {
+				captchas = append(captchas, LabeledCaptcha{Path: path, Answer: record.Answer})
+			}
+		case !os.IsNotExist(err):
+			return fmt.Errorf("error reading record of %s: %w", path, err)
+		case !datasetIDPattern.MatchString(stem):
+			// Labelled by name. Dataset samples without their record were
+			// interrupted while being written and have no label.
+			answer, _, _ := strings.Cut(stem, "_")
+			captchas = append(captchas, LabeledCaptcha{Path: path, Answer: answer})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return captchas, nil
+}
+
+func isImageExtension(ext string) bool {
+	switch ext {
+	case ".png", ".jpg", ".jpeg", ".gif", ".bmp":
+		return true
+	}
+	return false
+}
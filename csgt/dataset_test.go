@@ -0,0 +1,174 @@
+package csgt
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	pngHeader  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	jpegHeader = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+)
+
+func readDatasetRecord(t *testing.T, path string) DatasetRecord {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record DatasetRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestDatasetSave(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDataset(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capturedAt := time.Date(2026, 10, 16, 8, 44, 5, 123e6, Location)
+
+	verified, err := d.Save(CaptchaSample{Image: pngHeader, Text: "k7mxpa", Solver: "tesseract", Variant: "default", Verified: true, CapturedAt: capturedAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(verified.ID, "20261016T014405.123Z-") || !datasetIDPattern.MatchString(verified.ID) {
+		t.Errorf("id = %q, want the UTC capture time and a random suffix", verified.ID)
+	}
+	if verified.Label != LabelVerified || verified.Answer != "k7mxpa" || verified.Image != verified.ID+".png" {
+		t.Errorf("verified record = %+v", verified)
+	}
+
+	rejected, err := d.Save(CaptchaSample{Image: jpegHeader, Text: "k7mxqa", Solver: "ocrspace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Label != LabelRejected || rejected.Answer != "" || rejected.Image != rejected.ID+".jpg" || rejected.CapturedAt.IsZero() {
+		t.Errorf("rejected record = %+v", rejected)
+	}
+
+	var files []string
+	filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	want := []string{
+		"rejected/" + rejected.ID + ".jpg",
+		"rejected/" + rejected.ID + ".json",
+		"verified/" + verified.ID + ".json",
+		"verified/" + verified.ID + ".png",
+	}
+	sort.Strings(files)
+	if strings.Join(files, " ") != strings.Join(want, " ") {
+		t.Errorf("files = %v, want %v and no temporary files", files, want)
+	}
+
+	image, err := os.ReadFile(filepath.Join(dir, "verified", verified.Image))
+	if err != nil || string(image) != string(pngHeader) {
+		t.Errorf("image = %q, %v; want the bytes as downloaded", image, err)
+	}
+	record := readDatasetRecord(t, filepath.Join(dir, "verified", verified.ID+".json"))
+	if record.ID != verified.ID || record.Text != "k7mxpa" || record.Solver != "tesseract" || record.Variant != "default" ||
+		!record.CapturedAt.Equal(capturedAt) {
+		t.Errorf("stored record = %+v, want %+v", record, *verified)
+	}
+}
+
+func TestDatasetRecordCaptcha(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDataset(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.RecordCaptcha(context.Background(), CaptchaSample{Image: []byte("not an image"), Text: "k7mxpa", Verified: true})
+	images, _ := filepath.Glob(filepath.Join(dir, LabelVerified, "*.bin"))
+	records, _ := filepath.Glob(filepath.Join(dir, LabelVerified, "*.json"))
+	if len(images) != 1 || len(records) != 1 {
+		t.Errorf("saved %v and %v, want a .bin image and its record", images, records)
+	}
+
+	// A failed write is logged, not returned.
+	if err := os.RemoveAll(filepath.Join(dir, "rejected")); err != nil {
+		t.Fatal(err)
+	}
+	d.RecordCaptcha(context.Background(), CaptchaSample{Image: pngHeader, Text: "k7mxpa"})
+	if _, err := d.Save(CaptchaSample{Image: pngHeader, Text: "k7mxpa"}); err == nil {
+		t.Error("Save into a missing directory succeeded")
+	}
+}
+
+func TestReadLabeledCaptchas(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDataset(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := d.Save(CaptchaSample{Image: pngHeader, Text: "k7mxpa", Verified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Save(CaptchaSample{Image: pngHeader, Text: "wrong1"}); err != nil {
+		t.Fatal(err)
+	}
+	fixed, err := d.Save(CaptchaSample{Image: pngHeader, Text: "wrong2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Labelled by hand after the fact.
+	fixed.Answer = "right2"
+	data, _ := json.Marshal(fixed)
+	if err := os.WriteFile(filepath.Join(dir, LabelRejected, fixed.ID+".json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string][]byte{
+		// Interrupted: the record was still a temporary file.
+		"verified/20261016T014405.123Z-0badc0de.png":      pngHeader,
+		"verified/20261016T014405.123Z-0badc0de.json.tmp": []byte(`{"answer": "ignored"}`),
+		"hand/abc234_2.png":                               pngHeader,
+		"hand/notes.txt":                                  []byte("not a captcha"),
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	captchas, err := ReadLabeledCaptchas(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LabeledCaptcha{
+		{filepath.Join(dir, "hand", "abc234_2.png"), "abc234"},
+		{filepath.Join(dir, LabelRejected, fixed.Image), "right2"},
+		{filepath.Join(dir, LabelVerified, verified.Image), "k7mxpa"},
+	}
+	if len(captchas) != len(want) {
+		t.Fatalf("got %v, want %v", captchas, want)
+	}
+	for i := range want {
+		if captchas[i] != want[i] {
+			t.Errorf("captcha %d = %+v, want %+v", i, captchas[i], want[i])
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, LabelVerified, verified.ID+".json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLabeledCaptchas(dir); err == nil {
+		t.Error("a garbled record was not reported")
+	}
+}
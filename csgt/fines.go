@@ -0,0 +1,108 @@
+package csgt
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//go:embed fines.json
+var finesJSON []byte
+
+// Fine is the penalty a decree clause sets for a violation, in VND.
+type Fine struct {
+	MinVND        int64 `json:"min_vnd"`
+	MaxVND        int64 `json:"max_vnd"`
+	LicensePoints int   `json:"license_points,omitempty"`
+}
+
+type fineEntry struct {
+	Decree        string `json:"decree"`
+	Article       int    `json:"article"`
+	Clause        int    `json:"clause"`
+	Point         string `json:"point"`
+	FineMin       int64  `json:"fine_min"`
+	FineMax       int64  `json:"fine_max"`
+	LicensePoints int    `json:"license_points"`
+	Description   string `json:"description"`
+}
+
+type fineTable struct {
+	Version string      `json:"version"`
+	Source  string      `json:"source"`
+	Entries []fineEntry `json:"entries"`
+
+	byKey map[string]fineEntry
+}
+
+var fines = loadFineTable(finesJSON)
+
+func fineKey(decree string, article, clause int, point string) string {
+	return fmt.Sprintf("%s.%d.%d.%s", decree, article, clause, strings.ToLower(point))
+}
+
+func loadFineTable(data []byte) *fineTable {
+	table := &fineTable{}
+	if err := json.Unmarshal(data, table); err != nil {
+		panic(fmt.Sprintf("csgt: invalid embedded fines.json: %v", err))
+	}
+	table.byKey = make(map[string]fineEntry, len(table.Entries))
+	for _, e := range table.Entries {
+		table.byKey[fineKey(e.Decree, e.Article, e.Clause, e.Point)] = e
+	}
+	return table
+}
+
+// FineTableVersion identifies the embedded fine table.
+func FineTableVersion() string {
+	return fines.Version
+}
+
+// LookupFine returns the fine range for a decoded behavior code.
+func LookupFine(code *BehaviorCode) (Fine, bool) {
+	if code == nil {
+		return Fine{}, false
+	}
+	e, ok := fines.byKey[fineKey(code.Decree, code.Article, code.Clause, code.Point)]
+	if !ok {
+		return Fine{}, false
+	}
+	return Fine{MinVND: e.FineMin, MaxVND: e.FineMax, LicensePoints: e.LicensePoints}, true
+}
+
+// FineEstimate totals the fines of a set of violations.
+type FineEstimate struct {
+	MinVND            int64  `json:"min_vnd"`
+	MaxVND            int64  `json:"max_vnd"`
+	OutstandingMinVND int64  `json:"outstanding_min_vnd"`
+	OutstandingMaxVND int64  `json:"outstanding_max_vnd"`
+	LicensePoints     int    `json:"license_points"`
+	Unknown           int    `json:"unknown"`
+	TableVersion      string `json:"table_version"`
+}
+
+// EstimateFines sums the fines of violations. Violations whose status is not
+// yet "Đã xử phạt" also count as outstanding; violations without a known
+// fine are counted in Unknown.
+func EstimateFines(violations []Violation) *FineEstimate {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	est := &FineEstimate{TableVersion: fines.Version}
+	for _, v := range violations {
+		if v.Fine == nil {
+			est.Unknown++
+			continue
+		}
+		est.MinVND += v.Fine.MinVND
+		est.MaxVND += v.Fine.MaxVND
+		est.LicensePoints += v.Fine.LicensePoints
+		if normalizeLabel(v.Status) != "da xu phat" {
+			est.OutstandingMinVND += v.Fine.MinVND
+			est.OutstandingMaxVND += v.Fine.MaxVND
+		}
+	}
+	return est
+}
@@ -0,0 +1,54 @@
+package csgt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"LicensePlatecheck/plate"
+)
+
+// Fingerprint identifies a violation across lookups. It hashes the
+// normalized plate, the parsed violation time, the location and the behavior
+// code, so differences in whitespace, letter case or diacritics between two
+// renderings of the same incident do not change it, while status and
+// resolution details are free to change. Violations whose time or behavior
+// could not be parsed fall back to their normalized text.
+func Fingerprint(v Violation) string {
+	licensePlate, err := plate.Normalize(v.LicensePlate)
+	if err != nil {
+		licensePlate = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToUpper(r)
+			}
+			return -1
+		}, removeDiacritics(v.LicensePlate))
+	}
+
+	violatedAt := normalizeLabel(v.ViolationTime)
+	if v.ViolatedAt != nil {
+		violatedAt = v.ViolatedAt.In(Location).Format("2006-01-02T15:04")
+	}
+
+	behavior := normalizeLabel(v.Behavior)
+	if v.BehaviorCode != nil {
+		behavior = v.BehaviorCode.Code
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		licensePlate,
+		violatedAt,
+		normalizeLabel(v.Location),
+		behavior,
+	}, "\x1f")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// assignIDs sets the ID of each violation from its fingerprint. It runs after
+// the violation time and behavior have been parsed.
+func assignIDs(violations []Violation) {
+	for i := range violations {
+		violations[i].ID = Fingerprint(violations[i])
+	}
+}
@@ -0,0 +1,63 @@
+package csgt
+
+import "testing"
+
+// parsedViolation fills in what the parser derives before assigning IDs.
+func parsedViolation(v Violation) Violation {
+	violations := []Violation{v}
+	parseViolationTimes(violations)
+	parseBehaviors(violations)
+	return violations[0]
+}
+
+func TestFingerprint(t *testing.T) {
+	base := Violation{
+		LicensePlate:  "98B3-785.78",
+		ViolationTime: "08:44, 16/10/2025",
+		Location:      "Km 95+900m, QL1A, Xã Kép, Bắc Ninh",
+		Behavior:      "16824.7.2.b.01.Điều khiển xe chạy quá tốc độ quy định từ 05 km/h đến dưới 10 km/h",
+		Status:        "Chưa xử phạt",
+	}
+	id := Fingerprint(parsedViolation(base))
+	if len(id) != 32 {
+		t.Fatalf("Fingerprint = %q, want 32 hex digits", id)
+	}
+
+	same := map[string]func(*Violation){
+		"plate form":       func(v *Violation) { v.LicensePlate = "98b378578" },
+		"time spacing":     func(v *Violation) { v.ViolationTime = "08:44 , 16/10/2025" },
+		"location case":    func(v *Violation) { v.Location = "km 95+900m,  QL1A, xa kep, BAC NINH:" },
+		"behavior wording": func(v *Violation) { v.Behavior = "16824.7.2.b.01.Chạy quá tốc độ" },
+		"status":           func(v *Violation) { v.Status = "Đã xử phạt" },
+		"resolution point": func(v *Violation) { v.ResolutionPoint = "Đường Xương Giang" },
+	}
+	for name, change := range same {
+		v := base
+		change(&v)
+		if got := Fingerprint(parsedViolation(v)); got != id {
+			t.Errorf("%s: Fingerprint = %s, want %s", name, got, id)
+		}
+	}
+
+	different := map[string]func(*Violation){
+		"plate":    func(v *Violation) { v.LicensePlate = "98B3-785.79" },
+		"time":     func(v *Violation) { v.ViolationTime = "08:45, 16/10/2025" },
+		"location": func(v *Violation) { v.Location = "Km 96, QL1A, Xã Kép, Bắc Ninh" },
+		"behavior": func(v *Violation) { v.Behavior = "16824.7.4.a.01.Điều khiển xe chạy quá tốc độ" },
+	}
+	for name, change := range different {
+		v := base
+		change(&v)
+		if got := Fingerprint(parsedViolation(v)); got == id {
+			t.Errorf("%s: Fingerprint did not change", name)
+		}
+	}
+}
+
+func TestFingerprintUnparsed(t *testing.T) {
+	a := Violation{LicensePlate: "XE-TAM 01", ViolationTime: "không rõ", Location: "Hà Nội", Behavior: "Vượt đèn đỏ"}
+	b := Violation{LicensePlate: "xe tam01", ViolationTime: "Không  rõ", Location: "ha noi", Behavior: "vuot den do"}
+	if Fingerprint(parsedViolation(a)) != Fingerprint(parsedViolation(b)) {
+		t.Error("unparsed violations differing only in case, spacing and diacritics got different fingerprints")
+	}
+}
@@ -0,0 +1,637 @@
+package csgt
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultGlyphTemplates is the template set used without a "templates"
+// option. It was cut from the fake server's captchas, so it only shows the
+// solver working; real captchas need a set trained on them, see
+// TrainGlyphTemplates.
+//
+//go:embed glyphs.txt
+var defaultGlyphTemplates string
+
+const (
+	// Glyphs are compared on a grid of this many cells, each holding the
+	// fraction of it covered by ink.
+	glyphGridW = 8
+	glyphGridH = 12
+
+	// defaultGlyphMinScore is the lowest match score accepted for a glyph;
+	// below it the solver gives up so the chain can try the next solver.
+	defaultGlyphMinScore = 0.75
+
+	// lineCoverage is the share of columns a straight line must cross in ink
+	// to be treated as a noise line.
+	lineCoverage  = 0.7
+	maxNoiseLines = 8
+
+	// glyphSizeWeight scales the penalty for a glyph whose size differs from
+	// a template's, which tells "o" from "O" and "0" once both are
+	// normalized to the same grid.
+	glyphSizeWeight = 0.3
+)
+
+func init() {
+	RegisterSolver("builtin", func(cfg SolverConfig) (CaptchaSolver, error) {
+		solver, err := NewGlyphSolver(cfg.Options["templates"])
+		if err != nil {
+			return nil, err
+		}
+		if raw := cfg.Options["min_score"]; raw != "" {
+			score, err := strconv.ParseFloat(raw, 64)
+			if err != nil || score < 0 || score > 1 {
+				return nil, fmt.Errorf("invalid min_score %q: want a number between 0 and 1", raw)
+			}
+			solver.MinScore = score
+		}
+		return solver, nil
+	})
+}
+
+// glyphTemplate is one known character.
+type glyphTemplate struct {
+	char          rune
+	width, height int
+	grid          []float64
+}
+
+// GlyphSolver reads captchas without external tools: it binarizes the image,
+// removes straight noise lines and speckles, cuts the text into glyphs and
+// matches each glyph against bitmap templates.
+type GlyphSolver struct {
+	templates []glyphTemplate
+	stroke    float64 // stroke width of the templates, in pixels
+
+	// MinScore is the lowest match score, between 0 and 1, accepted for a
+	// glyph; a captcha with a worse glyph is reported as unreadable.
+	MinScore float64
+}
+
+// NewGlyphSolver loads the templates at path, as written by
+// TrainGlyphTemplates, or the embedded default set when path is empty.
+func NewGlyphSolver(path string) (*GlyphSolver, error) {
+	if path == "" {
+		templates, stroke, err := parseGlyphTemplates(strings.NewReader(defaultGlyphTemplates))
+		if err != nil {
+			return nil, fmt.Errorf("error reading embedded glyph templates: %w", err)
+		}
+		return &GlyphSolver{templates: templates, stroke: stroke, MinScore: defaultGlyphMinScore}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening glyph templates: %w", err)
+	}
+	defer f.Close()
+
+	templates, stroke, err := parseGlyphTemplates(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading glyph templates: %w", err)
+	}
+	return &GlyphSolver{templates: templates, stroke: stroke, MinScore: defaultGlyphMinScore}, nil
+}
+
+// parseGlyphTemplates reads a template file. Each "glyph <char>" line is
+// followed by the rows of its bitmap cropped to the ink, "#" for ink and "."
+// for background; a character may have several bitmaps. "stroke" is the width
+// in pixels of a vertical stroke in these bitmaps, which the solver compares
+// with the strokes of a captcha to work out how much it is scaled. Lines
+// starting with "//" are comments.
+func parseGlyphTemplates(r io.Reader) ([]glyphTemplate, float64, error) {
+	var (
+		templates []glyphTemplate
+		stroke    = 1.0
+		char      rune
+		rows      []string
+	)
+	flush := func() error {
+		if char == 0 {
+			return nil
+		}
+		if len(rows) == 0 {
+			return fmt.Errorf("glyph %q has no rows", char)
+		}
+		width := len(rows[0])
+		for _, row := range rows {
+			if len(row) != width {
+				return fmt.Errorf("glyph %q has rows of different widths", char)
+			}
+		}
+		templates = append(templates, glyphTemplate{
+			char:   char,
+			width:  width,
+			height: len(rows),
+			grid: coverageGrid(width, len(rows), func(x, y int) bool {
+				return rows[y][x] == '#'
+			}),
+		})
+		char, rows = 0, nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "//"):
+		case strings.HasPrefix(text, "stroke "):
+			value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(text, "stroke ")), 64)
+			if err != nil || value <= 0 {
+				return nil, 0, fmt.Errorf("line %d: invalid stroke %q", line, text)
+			}
+			stroke = value
+		case strings.HasPrefix(text, "glyph "):
+			if err := flush(); err != nil {
+				return nil, 0, err
+			}
+			runes := []rune(strings.TrimSpace(strings.TrimPrefix(text, "glyph ")))
+			if len(runes) != 1 {
+				return nil, 0, fmt.Errorf("line %d: want one character after glyph", line)
+			}
+			char = runes[0]
+		default:
+			if char == 0 {
+				return nil, 0, fmt.Errorf("line %d: bitmap row outside a glyph", line)
+			}
+			if strings.Trim(text, "#.") != "" {
+				return nil, 0, fmt.Errorf("line %d: bitmap rows may only contain # and .", line)
+			}
+			rows = append(rows, text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if err := flush(); err != nil {
+		return nil, 0, err
+	}
+	if len(templates) == 0 {
+		return nil, 0, fmt.Errorf("no glyphs defined")
+	}
+	return templates, stroke, nil
+}
+
+// Name implements CaptchaSolver.
+func (s *GlyphSolver) Name() string {
+	return "builtin"
+}
+
+// Solve implements CaptchaSolver.
+func (s *GlyphSolver) Solve(ctx context.Context, img image.Image) (string, error) {
+	text, _, err := s.SolveConfidence(ctx, img)
+	return text, err
+}
+
+// SolveConfidence implements ConfidenceSolver. The confidence is the score
+// of the worst matching glyph.
+func (s *GlyphSolver) SolveConfidence(ctx context.Context, img image.Image) (string, float64, error) {
+	b, stroke := cleanCaptcha(img)
+	scale := stroke / s.stroke
+	spans := b.segment(s.advance()*scale, minGlyphInk(stroke))
+	if len(spans) == 0 {
+		return "", 0, errNoText
+	}
+
+	var text strings.Builder
+	confidence := 1.0
+	for i, span := range spans {
+		if err := ctx.Err(); err != nil {
+			return "", 0, err
+		}
+		char, score := s.classify(b, span, scale)
+		if score < s.MinScore {
+			return "", 0, fmt.Errorf("glyph %d unreadable (best match %q scored %.2f)", i+1, char, score)
+		}
+		text.WriteRune(char)
+		confidence = min(confidence, score)
+	}
+	return text.String(), max(confidence, 0), nil
+}
+
+// cleanCaptcha binarizes img and erases its noise lines and speckles. It
+// also returns the stroke width of the text.
+func cleanCaptcha(img image.Image) (*binaryImage, float64) {
+	b := newBinaryImage(img)
+	stroke := b.strokeWidth()
+	b.removeLines(stroke)
+	b.removeSpeckles(max(2, int(stroke*stroke/2)))
+	return b, stroke
+}
+
+// minGlyphInk is the fewest ink pixels a glyph of the given stroke width has;
+// smaller spans are line remnants.
+func minGlyphInk(stroke float64) int {
+	return int(3 * stroke * stroke)
+}
+
+// advance estimates the horizontal distance between glyphs in template
+// pixels: the median template width plus one pixel of spacing.
+func (s *GlyphSolver) advance() float64 {
+	widths := make([]int, len(s.templates))
+	for i, t := range s.templates {
+		widths[i] = t.width
+	}
+	sort.Ints(widths)
+	return float64(widths[len(widths)/2]) + s.stroke
+}
+
+// classify returns the template that best matches the glyph in span and its
+// score.
+func (s *GlyphSolver) classify(b *binaryImage, span glyphSpan, scale float64) (rune, float64) {
+	top, bottom := b.rowRange(span.x0, span.x1)
+	width, height := span.x1-span.x0, bottom-top
+	grid := coverageGrid(width, height, func(x, y int) bool {
+		return b.at(span.x0+x, top+y)
+	})
+
+	best, bestScore := '?', math.Inf(-1)
+	for _, t := range s.templates {
+		var diff float64
+		for i := range grid {
+			diff += math.Abs(grid[i] - t.grid[i])
+		}
+		shape := 1 - diff/float64(len(grid))
+
+		size := math.Abs(math.Log(float64(width)/scale/float64(t.width))) +
+			math.Abs(math.Log(float64(height)/scale/float64(t.height)))
+		score := shape - glyphSizeWeight*size/2
+		if score > bestScore {
+			best, bestScore = t.char, score
+		}
+	}
+	return best, bestScore
+}
+
+// coverageGrid samples a w×h bitmap onto the comparison grid, each cell
+// holding the fraction of its area covered by ink.
+func coverageGrid(w, h int, ink func(x, y int) bool) []float64 {
+	grid := make([]float64, glyphGridW*glyphGridH)
+	if w == 0 || h == 0 {
+		return grid
+	}
+	sx, sy := float64(glyphGridW)/float64(w), float64(glyphGridH)/float64(h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !ink(x, y) {
+				continue
+			}
+			// The pixel covers [x*sx, (x+1)*sx) × [y*sy, (y+1)*sy) in grid
+			// units; share it among the cells it overlaps.
+			gx0, gx1 := float64(x)*sx, float64(x+1)*sx
+			gy0, gy1 := float64(y)*sy, float64(y+1)*sy
+			for cy := int(gy0); cy < glyphGridH && float64(cy) < gy1; cy++ {
+				oy := math.Min(gy1, float64(cy+1)) - math.Max(gy0, float64(cy))
+				for cx := int(gx0); cx < glyphGridW && float64(cx) < gx1; cx++ {
+					ox := math.Min(gx1, float64(cx+1)) - math.Max(gx0, float64(cx))
+					grid[cy*glyphGridW+cx] += ox * oy
+				}
+			}
+		}
+	}
+	return grid
+}
+
+// binaryImage is a captcha split into ink and background.
+type binaryImage struct {
+	w, h int
+	ink  []bool
+}
+
+// newBinaryImage thresholds img with Otsu's method. Text is assumed to be
+// darker than the background; images that come out mostly ink are inverted.
+func newBinaryImage(img image.Image) *binaryImage {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	gray := make([]uint8, w*h)
+	var hist [256]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y
+			gray[y*w+x] = v
+			hist[v]++
+		}
+	}
+
+	threshold := otsuThreshold(hist, w*h)
+	b := &binaryImage{w: w, h: h, ink: make([]bool, w*h)}
+	inked := 0
+	for i, v := range gray {
+		if v <= threshold {
+			b.ink[i] = true
+			inked++
+		}
+	}
+	if inked > w*h/2 {
+		for i := range b.ink {
+			b.ink[i] = !b.ink[i]
+		}
+	}
+	return b
+}
+
+// otsuThreshold returns the gray level that best separates the two classes
+// of the histogram.
+func otsuThreshold(hist [256]int, total int) uint8 {
+	var sum float64
+	for i, n := range hist {
+		sum += float64(i * n)
+	}
+
+	var sumBack, weightBack float64
+	var best float64
+	var threshold uint8
+	for i, n := range hist {
+		weightBack += float64(n)
+		if weightBack == 0 {
+			continue
+		}
+		weightFore := float64(total) - weightBack
+		if weightFore == 0 {
+			break
+		}
+		sumBack += float64(i * n)
+		meanBack := sumBack / weightBack
+		meanFore := (sum - sumBack) / weightFore
+		between := weightBack * weightFore * (meanBack - meanFore) * (meanBack - meanFore)
+		if between > best {
+			best = between
+			threshold = uint8(i)
+		}
+	}
+	return threshold
+}
+
+func (b *binaryImage) at(x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.w && y < b.h && b.ink[y*b.w+x]
+}
+
+// strokeWidth estimates the width of a vertical stroke as the median length
+// of horizontal ink runs.
+func (b *binaryImage) strokeWidth() float64 {
+	var runs []int
+	for y := 0; y < b.h; y++ {
+		run := 0
+		for x := 0; x <= b.w; x++ {
+			if b.at(x, y) {
+				run++
+				continue
+			}
+			if run > 0 {
+				runs = append(runs, run)
+				run = 0
+			}
+		}
+	}
+	if len(runs) == 0 {
+		return 1
+	}
+	sort.Ints(runs)
+	return float64(runs[len(runs)/2])
+}
+
+// verticalRun returns the rows [top, bottom) of the ink run through (x, y).
+func (b *binaryImage) verticalRun(x, y int) (int, int) {
+	top, bottom := y, y+1
+	for b.at(x, top-1) {
+		top--
+	}
+	for b.at(x, bottom) {
+		bottom++
+	}
+	return top, bottom
+}
+
+// removeLines erases straight lines drawn across the whole captcha. A line
+// is found by trying every pair of end rows and counting the columns where
+// it runs through thin ink, give or take half a stroke for lines that were
+// scaled up into staircases; counting only thin runs keeps a row of glyphs
+// from passing for a line. Only runs no thicker than the line are erased, so
+// glyph strokes it crosses or runs along stay intact.
+func (b *binaryImage) removeLines(stroke float64) {
+	if b.w < 2 {
+		return
+	}
+	tolerance := int(stroke / 2)
+	maxStroke := int(math.Ceil(stroke * 1.5))
+
+	for n := 0; n < maxNoiseLines; n++ {
+		// near[y*w+x] is set when thin ink lies within tolerance of (x, y).
+		thin := b.thinRuns(maxStroke)
+		near := make([]bool, len(thin))
+		for x := 0; x < b.w; x++ {
+			for y := 0; y < b.h; y++ {
+				if !thin[y*b.w+x] {
+					continue
+				}
+				for yy := max(0, y-tolerance); yy <= min(b.h-1, y+tolerance); yy++ {
+					near[yy*b.w+x] = true
+				}
+			}
+		}
+
+		bestHits, bestY0, bestY1 := 0, 0, 0
+		for y0 := 0; y0 < b.h; y0++ {
+			for y1 := 0; y1 < b.h; y1++ {
+				hits := 0
+				for x := 0; x < b.w; x++ {
+					if near[(y0+(y1-y0)*x/(b.w-1))*b.w+x] {
+						hits++
+					}
+				}
+				if hits > bestHits {
+					bestHits, bestY0, bestY1 = hits, y0, y1
+				}
+			}
+		}
+		if float64(bestHits) < lineCoverage*float64(b.w) {
+			return
+		}
+
+		maxThickness := min(b.lineThickness(bestY0, bestY1, tolerance)+1, maxStroke)
+		for x := 0; x < b.w; x++ {
+			y := bestY0 + (bestY1-bestY0)*x/(b.w-1)
+			for yy := y - tolerance; yy <= y+tolerance; yy++ {
+				if !b.at(x, yy) {
+					continue
+				}
+				top, bottom := b.verticalRun(x, yy)
+				if bottom-top <= maxThickness {
+					for erase := top; erase < bottom; erase++ {
+						b.ink[erase*b.w+x] = false
+					}
+				}
+			}
+		}
+	}
+}
+
+// thinRuns marks the ink pixels whose vertical run is at most maxHeight.
+func (b *binaryImage) thinRuns(maxHeight int) []bool {
+	thin := make([]bool, len(b.ink))
+	for x := 0; x < b.w; x++ {
+		for y := 0; y < b.h; {
+			if !b.at(x, y) {
+				y++
+				continue
+			}
+			top, bottom := b.verticalRun(x, y)
+			if bottom-top <= maxHeight {
+				for yy := top; yy < bottom; yy++ {
+					thin[yy*b.w+x] = true
+				}
+			}
+			y = bottom
+		}
+	}
+	return thin
+}
+
+// lineThickness is the median height of the ink runs along the line from
+// row y0 to row y1.
+func (b *binaryImage) lineThickness(y0, y1, tolerance int) int {
+	var runs []int
+	for x := 0; x < b.w; x++ {
+		y := y0 + (y1-y0)*x/(b.w-1)
+		for yy := y - tolerance; yy <= y+tolerance; yy++ {
+			if b.at(x, yy) {
+				top, bottom := b.verticalRun(x, yy)
+				runs = append(runs, bottom-top)
+				break
+			}
+		}
+	}
+	if len(runs) == 0 {
+		return 1
+	}
+	sort.Ints(runs)
+	return runs[len(runs)/2]
+}
+
+// removeSpeckles erases 8-connected ink components smaller than minArea.
+func (b *binaryImage) removeSpeckles(minArea int) {
+	seen := make([]bool, len(b.ink))
+	var stack, component []int
+	for start := range b.ink {
+		if !b.ink[start] || seen[start] {
+			continue
+		}
+		seen[start] = true
+		stack = append(stack[:0], start)
+		component = component[:0]
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			component = append(component, i)
+			x, y := i%b.w, i/b.w
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if !b.at(nx, ny) {
+						continue
+					}
+					if j := ny*b.w + nx; !seen[j] {
+						seen[j] = true
+						stack = append(stack, j)
+					}
+				}
+			}
+		}
+		if len(component) < minArea {
+			for _, i := range component {
+				b.ink[i] = false
+			}
+		}
+	}
+}
+
+// rowRange returns the rows [top, bottom) holding ink between columns x0
+// and x1.
+func (b *binaryImage) rowRange(x0, x1 int) (int, int) {
+	top, bottom := b.h, 0
+	for y := 0; y < b.h; y++ {
+		for x := x0; x < x1; x++ {
+			if b.at(x, y) {
+				top = min(top, y)
+				bottom = max(bottom, y+1)
+				break
+			}
+		}
+	}
+	return top, bottom
+}
+
+// glyphSpan is the columns [x0, x1) of one glyph.
+type glyphSpan struct {
+	x0, x1 int
+}
+
+// segment cuts the text at empty columns. Spans much wider than advance
+// hold touching glyphs and are split at the emptiest columns near where the
+// glyph boundaries should be. Spans with less than minInk pixels are line
+// remnants and dropped.
+func (b *binaryImage) segment(advance float64, minInk int) []glyphSpan {
+	columns := make([]int, b.w)
+	for x := 0; x < b.w; x++ {
+		for y := 0; y < b.h; y++ {
+			if b.at(x, y) {
+				columns[x]++
+			}
+		}
+	}
+
+	var spans []glyphSpan
+	start := -1
+	for x := 0; x <= b.w; x++ {
+		inked := x < b.w && columns[x] > 0
+		switch {
+		case inked && start < 0:
+			start = x
+		case !inked && start >= 0:
+			ink := 0
+			for _, count := range columns[start:x] {
+				ink += count
+			}
+			if ink >= minInk {
+				spans = append(spans, splitSpan(columns, glyphSpan{start, x}, advance)...)
+			}
+			start = -1
+		}
+	}
+	return spans
+}
+
+func splitSpan(columns []int, span glyphSpan, advance float64) []glyphSpan {
+	width := float64(span.x1 - span.x0)
+	if advance <= 0 || width < 1.5*advance {
+		return []glyphSpan{span}
+	}
+
+	parts := int(math.Round(width / advance))
+	var spans []glyphSpan
+	x0 := span.x0
+	for i := 1; i < parts; i++ {
+		ideal := span.x0 + int(float64(i)*width/float64(parts))
+		window := max(1, int(advance/3))
+		cut := ideal
+		for x := max(x0+1, ideal-window); x <= min(span.x1-1, ideal+window); x++ {
+			if columns[x] < columns[cut] {
+				cut = x
+			}
+		}
+		spans = append(spans, glyphSpan{x0, cut})
+		x0 = cut
+	}
+	return append(spans, glyphSpan{x0, span.x1})
+}
@@ -0,0 +1,191 @@
+package csgt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"LicensePlatecheck/internal/fakecsgt"
+)
+
+// fixtureAnswers cover every character of the fake server's charset.
+var fixtureAnswers = []string{"abcdef", "ghijkm", "npqrst", "uvwxyz", "234567", "89k7mx"}
+
+// fixtureCaptcha renders answer as the fake server does and preprocesses it
+// with the default pipeline, as the solvers see it during a lookup.
+func fixtureCaptcha(answer string) image.Image {
+	return DefaultPipeline().Apply(fakecsgt.RenderCaptcha(answer))
+}
+
+func TestGlyphSegmentation(t *testing.T) {
+	solver, err := NewGlyphSolver("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, answer := range fixtureAnswers {
+		b, stroke := cleanCaptcha(fixtureCaptcha(answer))
+		if stroke < 3 || stroke > 5 {
+			t.Errorf("%s: stroke %g, want about 4 for a font scaled 4 times", answer, stroke)
+		}
+
+		spans := b.segment(solver.advance()*stroke/solver.stroke, minGlyphInk(stroke))
+		if len(spans) != len(answer) {
+			t.Fatalf("%s: cut into %d glyphs, want %d", answer, len(spans), len(answer))
+		}
+		for i, span := range spans {
+			if span.x1 <= span.x0 || (i > 0 && span.x0 < spans[i-1].x1) {
+				t.Errorf("%s: spans %v are not ordered and disjoint", answer, spans)
+				break
+			}
+		}
+
+		if counted := b.segmentCount(len(answer), minGlyphInk(stroke)); len(counted) != len(answer) {
+			t.Errorf("%s: segmentCount cut %d glyphs, want %d", answer, len(counted), len(answer))
+		}
+	}
+}
+
+func TestGlyphSolverEmbeddedTemplates(t *testing.T) {
+	solver, err := NewSolver(SolverConfig{Name: "builtin"})
+	if err != nil {
+		t.Fatalf("builtin without options: %v", err)
+	}
+	for _, answer := range fixtureAnswers {
+		text, confidence, err := solver.(ConfidenceSolver).SolveConfidence(context.Background(), fixtureCaptcha(answer))
+		if err != nil {
+			t.Errorf("%s: %v", answer, err)
+			continue
+		}
+		if text != answer || confidence < defaultGlyphMinScore || confidence > 1 {
+			t.Errorf("read %q with confidence %.2f, want %q", text, confidence, answer)
+		}
+	}
+}
+
+func TestGlyphSolverUnreadable(t *testing.T) {
+	solver, err := NewGlyphSolver("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blank := image.NewGray(image.Rect(0, 0, 200, 60))
+	for i := range blank.Pix {
+		blank.Pix[i] = 255
+	}
+	if text, err := solver.Solve(context.Background(), blank); !errors.Is(err, errNoText) {
+		t.Errorf("blank captcha read as %q, %v; want %v", text, err, errNoText)
+	}
+
+	solver.MinScore = 1.01
+	if text, err := solver.Solve(context.Background(), fixtureCaptcha("abcdef")); err == nil {
+		t.Errorf("read %q above a perfect score", text)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	solver.MinScore = defaultGlyphMinScore
+	if _, err := solver.Solve(ctx, fixtureCaptcha("abcdef")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Solve with a cancelled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestParseGlyphTemplates(t *testing.T) {
+	templates, stroke, err := parseGlyphTemplates(strings.NewReader(`// comment
+stroke 2
+glyph a
+.##.
+#..#
+glyph a
+##
+glyph 1
+#
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stroke != 2 || len(templates) != 3 {
+		t.Fatalf("got %d templates with stroke %g, want 3 with stroke 2", len(templates), stroke)
+	}
+	if first := templates[0]; first.char != 'a' || first.width != 4 || first.height != 2 {
+		t.Errorf("first template = %c %dx%d, want a 4x2", first.char, first.width, first.height)
+	}
+
+	for name, input := range map[string]string{
+		"empty":              "// nothing here\n",
+		"glyph without rows": "glyph a\nglyph b\n#\n",
+		"uneven rows":        "glyph a\n##\n#\n",
+		"row outside glyph":  "#.#\n",
+		"bad row":            "glyph a\n#x#\n",
+		"two characters":     "glyph ab\n#\n",
+		"bad stroke":         "stroke -1\nglyph a\n#\n",
+	} {
+		if _, _, err := parseGlyphTemplates(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+// TestGlyphTrainingRoundTrip trains templates on rendered captchas, loads
+// the file back and reads captchas it was not trained on.
+func TestGlyphTrainingRoundTrip(t *testing.T) {
+	const charset = "abcdefghijkmnpqrstuvwxyz23456789"
+	var captchas []TrainingCaptcha
+	for i := 0; i < 40; i++ {
+		var answer strings.Builder
+		for j := 0; j < 6; j++ {
+			answer.WriteByte(charset[(i*7+j*5)%len(charset)])
+		}
+		captchas = append(captchas, TrainingCaptcha{Image: fixtureCaptcha(answer.String()), Answer: answer.String()})
+	}
+	// A captcha that does not cut into its answer's length is skipped.
+	blank := image.NewGray(image.Rect(0, 0, 200, 60))
+	for i := range blank.Pix {
+		blank.Pix[i] = 255
+	}
+	captchas = append(captchas, TrainingCaptcha{Image: blank, Answer: "abcdef"})
+
+	var buf bytes.Buffer
+	training, err := TrainGlyphTemplates(&buf, captchas, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if training.Captchas != 41 || training.Used != 40 || training.Templates == 0 || training.Stroke != 4 {
+		t.Errorf("training = %s, want 40/41 captchas used with stroke 4", training)
+	}
+	if len(training.Cuts) != len(charset) {
+		t.Errorf("cut %d characters, want %d", len(training.Cuts), len(charset))
+	}
+
+	path := filepath.Join(t.TempDir(), "glyphs.txt")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	solver, err := NewGlyphSolver(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(solver.templates) != training.Templates || solver.stroke != training.Stroke {
+		t.Errorf("loaded %d templates with stroke %g, trained %d with stroke %g",
+			len(solver.templates), solver.stroke, training.Templates, training.Stroke)
+	}
+	for _, answer := range fixtureAnswers {
+		if text, err := solver.Solve(context.Background(), fixtureCaptcha(answer)); err != nil || text != answer {
+			t.Errorf("read %q, %v; want %q", text, err, answer)
+		}
+	}
+
+	if _, err := TrainGlyphTemplates(&buf, captchas, 0); err == nil {
+		t.Error("trained with no templates per character")
+	}
+	if _, err := TrainGlyphTemplates(&buf, captchas[40:], 2); err == nil {
+		t.Error("trained without a usable captcha")
+	}
+	if _, err := NewGlyphSolver(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("loaded a missing template file")
+	}
+}
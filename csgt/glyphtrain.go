@@ -0,0 +1,336 @@
+package csgt
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	// maxGlyphCuts bounds the cuts of one character that are compared with
+	// each other while training, which takes time quadratic in their number.
+	maxGlyphCuts = 500
+
+	// minGlyphSupport is the fewest cuts a template must stand for. A glyph
+	// seen once is as likely a mislabelled captcha as a rare shape.
+	minGlyphSupport = 2
+
+	// glyphConflictDistance is how close templates of different characters
+	// may be; the one fewer cuts agree with is dropped.
+	glyphConflictDistance = 0.05
+)
+
+// TrainingCaptcha is a preprocessed captcha with its known answer.
+type TrainingCaptcha struct {
+	Image  image.Image
+	Answer string
+}
+
+// GlyphTraining tells what went into a template set.
+type GlyphTraining struct {
+	Captchas  int          // captchas offered
+	Used      int          // captchas cut into as many glyphs as their answer has characters
+	Cuts      map[rune]int // glyphs cut per character
+	Templates int          // templates written
+	Dropped   int          // templates left out for too little support or a conflict
+	Stroke    float64      // stroke width of the templates
+}
+
+// glyphCut is one glyph cut out of a training captcha, or a template
+// standing for support such cuts.
+type glyphCut struct {
+	width, height int
+	ink           []bool
+	grid          []float64
+	support       int
+}
+
+// trainedGlyph is a candidate template.
+type trainedGlyph struct {
+	char rune
+	glyphCut
+}
+
+// TrainGlyphTemplates cuts each captcha into as many glyphs as its answer
+// has characters, pairs the glyphs with those characters and writes up to
+// perChar representative bitmaps of every character to w, in the format
+// NewGlyphSolver reads. Captchas that do not cut into the right number of
+// glyphs are skipped. The captchas must be preprocessed the way the solver
+// will see them.
+func TrainGlyphTemplates(w io.Writer, captchas []TrainingCaptcha, perChar int) (*GlyphTraining, error) {
+	if perChar < 1 {
+		return nil, fmt.Errorf("need at least one template per character, got %d", perChar)
+	}
+
+	training := &GlyphTraining{Captchas: len(captchas), Cuts: make(map[rune]int)}
+	cuts := make(map[rune][]glyphCut)
+	var strokes []float64
+	for _, captcha := range captchas {
+		answer := []rune(captcha.Answer)
+		if len(answer) == 0 {
+			continue
+		}
+		b, stroke := cleanCaptcha(captcha.Image)
+		spans := b.segmentCount(len(answer), minGlyphInk(stroke))
+		if spans == nil {
+			continue
+		}
+
+		training.Used++
+		strokes = append(strokes, stroke)
+		for i, span := range spans {
+			char := answer[i]
+			training.Cuts[char]++
+			if len(cuts[char]) < maxGlyphCuts {
+				cuts[char] = append(cuts[char], b.cut(span))
+			}
+		}
+	}
+	if training.Used == 0 {
+		return nil, fmt.Errorf("none of the %d captchas could be cut into glyphs", len(captchas))
+	}
+	sort.Float64s(strokes)
+	training.Stroke = strokes[len(strokes)/2]
+
+	chars := make([]rune, 0, len(cuts))
+	for char := range cuts {
+		chars = append(chars, char)
+	}
+	sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
+
+	var glyphs []trainedGlyph
+	for _, char := range chars {
+		for _, cut := range representativeCuts(cuts[char], perChar) {
+			glyphs = append(glyphs, trainedGlyph{char, cut})
+		}
+	}
+	kept := resolveGlyphs(glyphs)
+	training.Dropped = len(glyphs) - len(kept)
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("no character was cut from at least %d captchas", minGlyphSupport)
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "// Glyph templates for the builtin captcha solver, written by train-captcha\n")
+	fmt.Fprintf(out, "// from %d of %d labeled captchas.\n", training.Used, training.Captchas)
+	fmt.Fprintf(out, "stroke %s\n", strconv.FormatFloat(training.Stroke, 'g', -1, 64))
+	for _, glyph := range kept {
+		fmt.Fprintf(out, "glyph %c\n", glyph.char)
+		row := make([]byte, glyph.width)
+		for y := 0; y < glyph.height; y++ {
+			for x := range row {
+				row[x] = '.'
+				if glyph.ink[y*glyph.width+x] {
+					row[x] = '#'
+				}
+			}
+			out.Write(row)
+			out.WriteByte('\n')
+		}
+		training.Templates++
+	}
+	if err := out.Flush(); err != nil {
+		return nil, fmt.Errorf("error writing glyph templates: %w", err)
+	}
+	return training, nil
+}
+
+// segmentCount cuts the text into exactly n glyphs. Spans are cut at empty
+// columns first, then the widest is split until there are n; it returns nil
+// when there are more than n spans to begin with.
+func (b *binaryImage) segmentCount(n, minInk int) []glyphSpan {
+	spans := b.segment(0, minInk)
+	if len(spans) == 0 || len(spans) > n {
+		return nil
+	}
+
+	columns := make([]int, b.w)
+	for x := 0; x < b.w; x++ {
+		for y := 0; y < b.h; y++ {
+			if b.at(x, y) {
+				columns[x]++
+			}
+		}
+	}
+	for len(spans) < n {
+		widest := 0
+		for i, span := range spans {
+			if span.x1-span.x0 > spans[widest].x1-spans[widest].x0 {
+				widest = i
+			}
+		}
+		span := spans[widest]
+		if span.x1-span.x0 < 2 {
+			return nil
+		}
+		halves := splitSpan(columns, span, float64(span.x1-span.x0)/2)
+		spans = append(spans[:widest], append(halves, spans[widest+1:]...)...)
+	}
+	return spans
+}
+
+// cut copies the glyph in span, cropped to its ink.
+func (b *binaryImage) cut(span glyphSpan) glyphCut {
+	top, bottom := b.rowRange(span.x0, span.x1)
+	cut := glyphCut{width: span.x1 - span.x0, height: max(bottom-top, 0)}
+	cut.ink = make([]bool, cut.width*cut.height)
+	for y := 0; y < cut.height; y++ {
+		for x := 0; x < cut.width; x++ {
+			cut.ink[y*cut.width+x] = b.at(span.x0+x, top+y)
+		}
+	}
+	cut.grid = coverageGrid(cut.width, cut.height, func(x, y int) bool {
+		return cut.ink[y*cut.width+x]
+	})
+	return cut
+}
+
+// glyphDistance is how far apart two cuts are, on the terms classify scores
+// a glyph against a template.
+func glyphDistance(a, b glyphCut) float64 {
+	var diff float64
+	for i := range a.grid {
+		diff += math.Abs(a.grid[i] - b.grid[i])
+	}
+	size := math.Abs(math.Log(float64(a.width)/float64(b.width))) +
+		math.Abs(math.Log(float64(a.height)/float64(b.height)))
+	return diff/float64(len(a.grid)) + glyphSizeWeight*size/2
+}
+
+// resolveGlyphs drops the templates with too little support, and of two
+// templates of different characters that look alike, the one with less.
+func resolveGlyphs(glyphs []trainedGlyph) []trainedGlyph {
+	var kept []trainedGlyph
+	for i, glyph := range glyphs {
+		if glyph.support < minGlyphSupport {
+			continue
+		}
+		conflict := false
+		for j, other := range glyphs {
+			if other.char == glyph.char || glyphDistance(glyph.glyphCut, other.glyphCut) >= glyphConflictDistance {
+				continue
+			}
+			if other.support > glyph.support || (other.support == glyph.support && j < i) {
+				conflict = true
+				break
+			}
+		}
+		if !conflict {
+			kept = append(kept, glyph)
+		}
+	}
+	return kept
+}
+
+// representativeCuts groups cuts into at most k clusters with k-medoids and
+// returns the medoids, largest cluster first, each with the size of its
+// cluster as support.
+func representativeCuts(cuts []glyphCut, k int) []glyphCut {
+	n := len(cuts)
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+		for j := range i {
+			dist[i][j] = glyphDistance(cuts[i], cuts[j])
+			dist[j][i] = dist[i][j]
+		}
+	}
+
+	// Start from the overall medoid, then repeatedly add the cut farthest
+	// from the medoids so far.
+	medoids := []int{medoid(dist, allIndexes(n))}
+	for len(medoids) < min(k, n) {
+		farthest, farthestDist := -1, 0.0
+		for i := range cuts {
+			if d := nearest(dist, medoids, i); d > farthestDist {
+				farthest, farthestDist = i, d
+			}
+		}
+		if farthest < 0 {
+			break // the rest are identical to a medoid
+		}
+		medoids = append(medoids, farthest)
+	}
+
+	var clusters [][]int
+	for iter := 0; iter < 10; iter++ {
+		clusters = make([][]int, len(medoids))
+		for i := range cuts {
+			best := 0
+			for m := range medoids {
+				if dist[i][medoids[m]] < dist[i][medoids[best]] {
+					best = m
+				}
+			}
+			clusters[best] = append(clusters[best], i)
+		}
+		changed := false
+		for m, members := range clusters {
+			if len(members) == 0 {
+				continue // another medoid is identical to this one
+			}
+			if c := medoid(dist, members); c != medoids[m] {
+				medoids[m], changed = c, true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	order := allIndexes(len(medoids))
+	sort.SliceStable(order, func(i, j int) bool { return len(clusters[order[i]]) > len(clusters[order[j]]) })
+	var result []glyphCut
+	for _, m := range order {
+		if len(clusters[m]) == 0 {
+			break
+		}
+		cut := cuts[medoids[m]]
+		cut.support = len(clusters[m])
+		result = append(result, cut)
+	}
+	return result
+}
+
+// medoid returns the member with the smallest total distance to the others.
+func medoid(dist [][]float64, members []int) int {
+	best, bestSum := members[0], math.Inf(1)
+	for _, i := range members {
+		var sum float64
+		for _, j := range members {
+			sum += dist[i][j]
+		}
+		if sum < bestSum {
+			best, bestSum = i, sum
+		}
+	}
+	return best
+}
+
+// nearest returns the distance from cut i to the closest of medoids.
+func nearest(dist [][]float64, medoids []int, i int) float64 {
+	d := math.Inf(1)
+	for _, m := range medoids {
+		d = min(d, dist[i][m])
+	}
+	return d
+}
+
+func allIndexes(n int) []int {
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return indexes
+}
+
+// String summarizes the training, e.g. "120/151 captchas, 32 characters,
+// 61 templates (3 dropped), stroke 2".
+func (t *GlyphTraining) String() string {
+	return fmt.Sprintf("%d/%d captchas, %d characters, %d templates (%d dropped), stroke %g",
+		t.Used, t.Captchas, len(t.Cuts), t.Templates, t.Dropped, t.Stroke)
+}
@@ -0,0 +1,129 @@
+package csgt
+
+import (
+	"context"
+	"time"
+)
+
+// Step names an upstream request made during a lookup attempt.
+type Step string
+
+const (
+	StepCaptcha Step = "captcha" // captcha image download
+	StepSubmit  Step = "submit"  // lookup form submission
+	StepResult  Step = "result"  // result page fetch
+)
+
+// Observer receives events from a Client while lookups run, e.g. to export
+// metrics. Methods are called with the lookup's context and must not block.
+// Implementations must be safe for concurrent use: a Client runs lookups in
+// parallel, and within one lookup SolverAttempt is called from a goroutine
+// per preprocessing pipeline (see SolveVariants).
+type Observer interface {
+	// UpstreamRequest reports one request to CSGT and how long it took,
+	// including reading the response body.
+	UpstreamRequest(ctx context.Context, step Step, d time.Duration, err error)
+
+	// SolverAttempt reports one run of a single captcha solver. A nil err
+	// means the solver produced text.
+	SolverAttempt(ctx context.Context, solver string, d time.Duration, err error)
+
+	// CaptchaSubmitted reports whether the upstream accepted a submitted
+	// captcha; rejections are the attempts that end in ErrCaptchaMismatch.
+	CaptchaSubmitted(ctx context.Context, accepted bool)
+
+	// ResultRetry reports a repeated fetch of the result page.
+	ResultRetry(ctx context.Context)
+
+	// LookupFinished reports the outcome of Lookup and the attempts it used.
+	LookupFinished(ctx context.Context, result *SubmitFormResponse, attempts int, err error)
+}
+
+// SkipObserver is an Observer that also wants to know about captcha reads
+// skipped by the CaptchaCheck. The client looks for it with a type assertion,
+// so Observers written before skips existed keep working.
+type SkipObserver interface {
+	Observer
+
+	// CaptchaSkipped reports a captcha read that was not submitted because
+	// it failed the CaptchaCheck; reason is SkipLowConfidence or
+	// SkipMalformed. Skips are not attempts.
+	CaptchaSkipped(ctx context.Context, reason string)
+}
+
+// NopObserver ignores every event. Embed it to implement only some methods.
+type NopObserver struct{}
+
+func (NopObserver) UpstreamRequest(context.Context, Step, time.Duration, error)     {}
+func (NopObserver) SolverAttempt(context.Context, string, time.Duration, error)     {}
+func (NopObserver) CaptchaSubmitted(context.Context, bool)                          {}
+func (NopObserver) CaptchaSkipped(context.Context, string)                          {}
+func (NopObserver) ResultRetry(context.Context)                                     {}
+func (NopObserver) LookupFinished(context.Context, *SubmitFormResponse, int, error) {}
+
+// WithObserver makes the client report lookup events to o.
+func WithObserver(o Observer) Option {
+	return func(c *Client) {
+		c.observer = o
+	}
+}
+
+type observerKey struct{}
+
+// withObserver lets solvers deep in a chain reach the client's observer.
+func withObserver(ctx context.Context, o Observer) context.Context {
+	return context.WithValue(ctx, observerKey{}, o)
+}
+
+func observerFrom(ctx context.Context) Observer {
+	if o, ok := ctx.Value(observerKey{}).(Observer); ok {
+		return o
+	}
+	return NopObserver{}
+}
+
+// Observers returns an Observer that passes every event to each of obs in
+// order.
+func Observers(obs ...Observer) Observer {
+	return multiObserver(obs)
+}
+
+type multiObserver []Observer
+
+func (m multiObserver) UpstreamRequest(ctx context.Context, step Step, d time.Duration, err error) {
+	for _, o := range m {
+		o.UpstreamRequest(ctx, step, d, err)
+	}
+}
+
+func (m multiObserver) SolverAttempt(ctx context.Context, solver string, d time.Duration, err error) {
+	for _, o := range m {
+		o.SolverAttempt(ctx, solver, d, err)
+	}
+}
+
+func (m multiObserver) CaptchaSubmitted(ctx context.Context, accepted bool) {
+	for _, o := range m {
+		o.CaptchaSubmitted(ctx, accepted)
+	}
+}
+
+func (m multiObserver) CaptchaSkipped(ctx context.Context, reason string) {
+	for _, o := range m {
+		if so, ok := o.(SkipObserver); ok {
+			so.CaptchaSkipped(ctx, reason)
+		}
+	}
+}
+
+func (m multiObserver) ResultRetry(ctx context.Context) {
+	for _, o := range m {
+		o.ResultRetry(ctx)
+	}
+}
+
+func (m multiObserver) LookupFinished(ctx context.Context, result *SubmitFormResponse, attempts int, err error) {
+	for _, o := range m {
+		o.LookupFinished(ctx, result, attempts, err)
+	}
+}
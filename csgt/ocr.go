@@ -0,0 +1,300 @@
+package csgt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// solvedCaptcha is a downloaded captcha and the text read from it.
+type solvedCaptcha struct {
+	image []byte
+	Read
+}
+
+func (c *Client) solveCaptcha(ctx context.Context, client *http.Client) (*solvedCaptcha, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.captchaURL(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating captcha request: %w", err)
+	}
+
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		c.observer.UpstreamRequest(ctx, StepCaptcha, time.Since(started), err)
+		return nil, fmt.Errorf("error downloading captcha: %w", err)
+	}
+	defer resp.Body.Close()
+
+	imageData, err := ioutil.ReadAll(resp.Body)
+	c.observer.UpstreamRequest(ctx, StepCaptcha, time.Since(started), err)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image data: %w", err)
+	}
+
+	// Decode the image
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %w", err)
+	}
+
+	winner, reads, ok := SolveCaptcha(ctx, c.solver, c.pipelines, c.vote, img)
+	if !ok {
+		if len(reads) == 1 {
+			return nil, reads[0].Err
+		}
+		errs := make([]string, len(reads))
+		for i, read := range reads {
+			errs[i] = read.Variant + ": " + read.Err.Error()
+		}
+		return nil, fmt.Errorf("every captcha read failed: %s", strings.Join(errs, "; "))
+	}
+	if len(reads) > 1 {
+		log.Printf("captcha vote (%s): %q by %s from variant %s, %s", c.vote, winner.Text, winner.Solver, winner.Variant, voteSummary(reads))
+	}
+	return &solvedCaptcha{image: imageData, Read: winner}, nil
+}
+
+// voteSummary lists what each variant read, e.g. "plain=k7mxp otsu=k7rnxp".
+func voteSummary(reads []Read) string {
+	parts := make([]string, len(reads))
+	for i, read := range reads {
+		text := read.Text
+		if read.Err != nil {
+			text = "-"
+		}
+		parts[i] = read.Variant + "=" + text
+	}
+	return strings.Join(parts, " ")
+}
+
+func init() {
+	RegisterSolver("tesseract", func(cfg SolverConfig) (CaptchaSolver, error) {
+		return &TesseractSolver{Binary: cfg.Options["binary"]}, nil
+	})
+	RegisterSolver("ocrspace", func(cfg SolverConfig) (CaptchaSolver, error) {
+		return &OCRSpaceSolver{APIKey: cfg.Options["api_key"], Endpoint: cfg.Options["endpoint"]}, nil
+	})
+}
+
+const (
+	// ocrSpacePartialParse is the OCRExitCode of a partly parsed image.
+	ocrSpacePartialParse = 2
+
+	// ocrSpacePartialConfidence is the confidence given to partial parses.
+	ocrSpacePartialConfidence = 0.5
+)
+
+// OCRSpaceSolver solves captchas with the paid OCR.space API.
+type OCRSpaceSolver struct {
+	APIKey   string
+	Endpoint string // defaults to the public OCR.space endpoint
+}
+
+// Name implements CaptchaSolver.
+func (s *OCRSpaceSolver) Name() string {
+	return "ocrspace"
+}
+
+// Remote implements RemoteSolver: every call is a paid API request.
+func (s *OCRSpaceSolver) Remote() bool {
+	return true
+}
+
+// Solve implements CaptchaSolver.
+func (s *OCRSpaceSolver) Solve(ctx context.Context, img image.Image) (string, error) {
+	text, _, err := s.SolveConfidence(ctx, img)
+	return text, err
+}
+
+// SolveConfidence implements ConfidenceSolver. OCR.space reports no score
+// per word, only whether it parsed the image fully (OCRExitCode 1) or partly
+// (2); a partial parse gets ocrSpacePartialConfidence.
+func (s *OCRSpaceSolver) SolveConfidence(ctx context.Context, img image.Image) (string, float64, error) {
+	// Create a temporary file to save image for encoding
+	tmpFile, err := ioutil.TempFile("", "captcha-ocr-*.jpg")
+	if err != nil {
+		return "", 0, fmt.Errorf("error creating temp file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	tmpFile.Close()
+	defer os.Remove(tmpPath)
+
+	// Save image to temp file
+	if err := imaging.Save(img, tmpPath, imaging.JPEGQuality(95)); err != nil {
+		return "", 0, fmt.Errorf("error saving temp image: %w", err)
+	}
+
+	// Read back the JPEG data
+	jpegData, err := ioutil.ReadFile(tmpPath)
+	if err != nil {
+		return "", 0, fmt.Errorf("error reading temp image: %w", err)
+	}
+
+	base64Image := base64.StdEncoding.EncodeToString(jpegData)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("apikey", s.APIKey)
+	writer.WriteField("base64image", "data:image/jpeg;base64,"+base64Image)
+	writer.Close()
+
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = ocrApiURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, body)
+	if err != nil {
+		return "", 0, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	ocrClient := &http.Client{Timeout: 20 * time.Second}
+	res, err := ocrClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("error sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("error reading response: %w", err)
+	}
+
+	var ocrResponse ocrSpaceResponse
+	if err := json.Unmarshal(responseBody, &ocrResponse); err != nil {
+		return "", 0, fmt.Errorf("error parsing JSON: %w", err)
+	}
+
+	if ocrResponse.IsErroredOnProcessing {
+		return "", 0, fmt.Errorf("OCR processing error: %s", ocrResponse.ErrorMessage)
+	}
+
+	if len(ocrResponse.ParsedResults) > 0 {
+		// Captchas have no spaces; OCR.space may still split the text.
+		text := strings.Join(strings.Fields(ocrResponse.ParsedResults[0].ParsedText), "")
+		confidence := 1.0
+		if ocrResponse.OCRExitCode == ocrSpacePartialParse {
+			confidence = ocrSpacePartialConfidence
+		}
+		return text, confidence, nil
+	}
+
+	return "", 0, fmt.Errorf("no text found")
+}
+
+// TesseractSolver solves captchas with a local tesseract binary.
+type TesseractSolver struct {
+	Binary string // defaults to "tesseract" on PATH
+}
+
+// Name implements CaptchaSolver.
+func (s *TesseractSolver) Name() string {
+	return "tesseract"
+}
+
+// Solve implements CaptchaSolver.
+func (s *TesseractSolver) Solve(ctx context.Context, img image.Image) (string, error) {
+	text, _, err := s.SolveConfidence(ctx, img)
+	return text, err
+}
+
+// SolveConfidence implements ConfidenceSolver. The confidence is that of the
+// least certain word in Tesseract's TSV output.
+func (s *TesseractSolver) SolveConfidence(ctx context.Context, img image.Image) (string, float64, error) {
+	// Save to temporary file
+	tmpFile, err := ioutil.TempFile("", "captcha-*.png")
+	if err != nil {
+		return "", 0, fmt.Errorf("error creating temp file: %w", err)
+	}
+	defer tmpFile.Close()
+	defer func() {
+		_ = os.Remove(tmpFile.Name())
+	}()
+
+	// Save processed image
+	if err := imaging.Save(img, tmpFile.Name()); err != nil {
+		return "", 0, fmt.Errorf("error saving temp image: %w", err)
+	}
+
+	binary := s.Binary
+	if binary == "" {
+		binary = "tesseract"
+	}
+
+	// Run Tesseract
+	cmd := exec.CommandContext(ctx, binary, tmpFile.Name(), "stdout",
+		"--psm", "7",
+		"--oem", "1",
+		"-l", "eng",
+		"-c", "tessedit_char_whitelist=0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+		"tsv")
+
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return "", 0, fmt.Errorf("tesseract error: %v", err)
+	}
+
+	return parseTesseractTSV(out.String())
+}
+
+// parseTesseractTSV joins the words of Tesseract's TSV output, which a
+// captcha has no spaces between, and returns the lowest word confidence
+// scaled to 0–1.
+func parseTesseractTSV(tsv string) (string, float64, error) {
+	lines := strings.Split(strings.TrimSpace(tsv), "\n")
+	header := strings.Split(lines[0], "\t")
+	confColumn, textColumn := -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case "conf":
+			confColumn = i
+		case "text":
+			textColumn = i
+		}
+	}
+	if confColumn < 0 || textColumn < 0 {
+		return "", 0, fmt.Errorf("unexpected tesseract output: %q", lines[0])
+	}
+
+	var text strings.Builder
+	confidence := 100.0
+	for _, line := range lines[1:] {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) <= textColumn {
+			continue
+		}
+		word := strings.TrimSpace(fields[textColumn])
+		conf, err := strconv.ParseFloat(fields[confColumn], 64)
+		// Rows other than words have a confidence of -1.
+		if err != nil || conf < 0 || word == "" {
+			continue
+		}
+		text.WriteString(word)
+		confidence = min(confidence, conf)
+	}
+	if text.Len() == 0 {
+		return "", 0, errNoText
+	}
+	return text.String(), confidence / 100, nil
+}
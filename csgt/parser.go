@@ -1,4 +1,4 @@
-package main
+package csgt
 
 import (
 	"strings"
@@ -69,6 +69,9 @@ func extractViolations(doc *goquery.Document) []Violation {
 	if len(violations) > 0 {
 		fullText := doc.Find("#bodyPrint123").Text()
 		parseResolutionPoints(fullText, violations)
+		parseViolationTimes(violations)
+		parseBehaviors(violations)
+		assignIDs(violations)
 	}
 
 	return violations
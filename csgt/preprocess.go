@@ -0,0 +1,309 @@
+package csgt
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// DefaultPreprocessing is the pipeline captchas go through when none is
+// configured.
+const DefaultPreprocessing = "grayscale,contrast:20"
+
+// Pipeline is a named list of preprocessing steps applied to a downloaded
+// captcha before it is handed to the solvers.
+type Pipeline struct {
+	Name  string
+	steps []preprocessStep
+	spec  string
+}
+
+type preprocessStep func(img image.Image) image.Image
+
+// DefaultPipeline returns the DefaultPreprocessing pipeline.
+func DefaultPipeline() Pipeline {
+	p, err := ParsePipeline("default", DefaultPreprocessing)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Preprocess prepares a downloaded captcha with the default pipeline.
+func Preprocess(img image.Image) image.Image {
+	return DefaultPipeline().Apply(img)
+}
+
+// Apply runs the steps of p over img.
+func (p Pipeline) Apply(img image.Image) image.Image {
+	for _, step := range p.steps {
+		img = step(img)
+	}
+	return img
+}
+
+// String returns the steps of p as they were configured.
+func (p Pipeline) String() string {
+	return p.spec
+}
+
+// ParsePipeline reads a comma-separated list of steps such as
+// "grayscale,threshold,median:3". Arguments follow the step name after
+// colons:
+//
+//	grayscale            convert to grayscale
+//	contrast:P           change contrast by P percent (-100 to 100)
+//	threshold[:T]        black and white at gray level T, Otsu's when omitted
+//	median[:N]           N×N median filter against salt-and-pepper noise (3)
+//	upscale[:F]          enlarge F times (2)
+//	dilate[:N]           thicken dark ink by N pixels (1)
+//	erode[:N]            thin dark ink by N pixels (1)
+//	crop:T[:R:B:L]       trim pixels off the top, right, bottom and left
+//	invert               swap dark and light
+func ParsePipeline(name, spec string) (Pipeline, error) {
+	p := Pipeline{Name: name, spec: spec}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		step, err := parseStep(entry)
+		if err != nil {
+			return Pipeline{}, fmt.Errorf("preprocessing %q: %w", name, err)
+		}
+		p.steps = append(p.steps, step)
+	}
+	if len(p.steps) == 0 {
+		return Pipeline{}, fmt.Errorf("preprocessing %q has no steps", name)
+	}
+	return p, nil
+}
+
+// ParsePipelines reads several pipelines separated by semicolons, each
+// optionally named with "name=", e.g.
+// "plain=grayscale,contrast:20; otsu=grayscale,threshold,median:3".
+// Unnamed pipelines are called v1, v2 and so on.
+func ParsePipelines(spec string) ([]Pipeline, error) {
+	var pipelines []Pipeline
+	names := make(map[string]bool)
+	for i, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name := "v" + strconv.Itoa(i+1)
+		if n, steps, ok := strings.Cut(entry, "="); ok {
+			name, entry = strings.TrimSpace(n), steps
+		}
+		if names[name] {
+			return nil, fmt.Errorf("preprocessing %q is defined twice", name)
+		}
+		names[name] = true
+
+		p, err := ParsePipeline(name, entry)
+		if err != nil {
+			return nil, err
+		}
+		pipelines = append(pipelines, p)
+	}
+	if len(pipelines) == 0 {
+		return nil, fmt.Errorf("no preprocessing pipelines")
+	}
+	return pipelines, nil
+}
+
+func parseStep(entry string) (preprocessStep, error) {
+	parts := strings.Split(entry, ":")
+	name := strings.ToLower(strings.TrimSpace(parts[0]))
+	args := make([]int, len(parts)-1)
+	for i, arg := range parts[1:] {
+		n, err := strconv.Atoi(strings.TrimSpace(arg))
+		if err != nil {
+			return nil, fmt.Errorf("step %q: invalid argument %q", entry, arg)
+		}
+		args[i] = n
+	}
+	// arg returns the single optional argument, or def without one.
+	arg := func(def, lo, hi int) (int, error) {
+		switch {
+		case len(args) == 0:
+			return def, nil
+		case len(args) > 1:
+			return 0, fmt.Errorf("step %q takes one argument", entry)
+		case args[0] < lo || args[0] > hi:
+			return 0, fmt.Errorf("step %q: argument must be between %d and %d", entry, lo, hi)
+		}
+		return args[0], nil
+	}
+
+	switch name {
+	case "grayscale":
+		if len(args) > 0 {
+			return nil, fmt.Errorf("step %q takes no argument", entry)
+		}
+		return func(img image.Image) image.Image { return imaging.Grayscale(img) }, nil
+
+	case "contrast":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("step %q needs a percentage", entry)
+		}
+		percent, err := arg(0, -100, 100)
+		if err != nil {
+			return nil, err
+		}
+		return func(img image.Image) image.Image {
+			return imaging.AdjustContrast(img, float64(percent))
+		}, nil
+
+	case "threshold":
+		level, err := arg(-1, 0, 255)
+		if err != nil {
+			return nil, err
+		}
+		return func(img image.Image) image.Image { return threshold(toGray(img), level) }, nil
+
+	case "median":
+		size, err := arg(3, 3, 15)
+		if err != nil {
+			return nil, err
+		}
+		if size%2 == 0 {
+			return nil, fmt.Errorf("step %q: size must be odd", entry)
+		}
+		return func(img image.Image) image.Image {
+			return rankFilter(toGray(img), size/2, func(window []uint8) uint8 {
+				sort.Slice(window, func(i, j int) bool { return window[i] < window[j] })
+				return window[len(window)/2]
+			})
+		}, nil
+
+	case "upscale":
+		factor, err := arg(2, 1, 8)
+		if err != nil {
+			return nil, err
+		}
+		return func(img image.Image) image.Image {
+			bounds := img.Bounds()
+			return imaging.Resize(img, bounds.Dx()*factor, bounds.Dy()*factor, imaging.Linear)
+		}, nil
+
+	case "dilate", "erode":
+		n, err := arg(1, 1, 10)
+		if err != nil {
+			return nil, err
+		}
+		// Ink is dark: dilating keeps the darkest pixel around each one,
+		// eroding the lightest.
+		pick := func(window []uint8) uint8 {
+			v := window[0]
+			for _, w := range window[1:] {
+				v = min(v, w)
+			}
+			return v
+		}
+		if name == "erode" {
+			pick = func(window []uint8) uint8 {
+				v := window[0]
+				for _, w := range window[1:] {
+					v = max(v, w)
+				}
+				return v
+			}
+		}
+		return func(img image.Image) image.Image { return rankFilter(toGray(img), n, pick) }, nil
+
+	case "crop":
+		var top, right, bottom, left int
+		switch len(args) {
+		case 1:
+			top, right, bottom, left = args[0], args[0], args[0], args[0]
+		case 4:
+			top, right, bottom, left = args[0], args[1], args[2], args[3]
+		default:
+			return nil, fmt.Errorf("step %q needs one or four margins", entry)
+		}
+		if min(top, right, bottom, left) < 0 {
+			return nil, fmt.Errorf("step %q: margins must not be negative", entry)
+		}
+		return func(img image.Image) image.Image {
+			b := img.Bounds()
+			if left+right >= b.Dx() || top+bottom >= b.Dy() {
+				// Nothing would be left; image.Rect would swap the corners.
+				return img
+			}
+			return imaging.Crop(img, image.Rect(b.Min.X+left, b.Min.Y+top, b.Max.X-right, b.Max.Y-bottom))
+		}, nil
+
+	case "invert":
+		if len(args) > 0 {
+			return nil, fmt.Errorf("step %q takes no argument", entry)
+		}
+		return func(img image.Image) image.Image { return imaging.Invert(img) }, nil
+	}
+	return nil, fmt.Errorf("unknown preprocessing step %q", name)
+}
+
+// toGray converts img to an 8-bit grayscale image with its origin at 0,0.
+func toGray(img image.Image) *image.Gray {
+	if gray, ok := img.(*image.Gray); ok && gray.Bounds().Min == (image.Point{}) {
+		return gray
+	}
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			gray.SetGray(x, y, color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray))
+		}
+	}
+	return gray
+}
+
+// threshold turns gray black and white at level, or at Otsu's threshold when
+// level is negative.
+func threshold(gray *image.Gray, level int) *image.Gray {
+	w, h := gray.Rect.Dx(), gray.Rect.Dy()
+	if level < 0 {
+		var hist [256]int
+		for y := 0; y < h; y++ {
+			for _, v := range gray.Pix[y*gray.Stride : y*gray.Stride+w] {
+				hist[v]++
+			}
+		}
+		level = int(otsuThreshold(hist, w*h))
+	}
+
+	out := image.NewGray(gray.Rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if int(gray.Pix[y*gray.Stride+x]) > level {
+				out.Pix[y*out.Stride+x] = 255
+			}
+		}
+	}
+	return out
+}
+
+// rankFilter replaces every pixel with pick of the square window of the
+// given radius around it, clipped at the edges.
+func rankFilter(gray *image.Gray, radius int, pick func(window []uint8) uint8) *image.Gray {
+	w, h := gray.Rect.Dx(), gray.Rect.Dy()
+	out := image.NewGray(gray.Rect)
+	window := make([]uint8, 0, (2*radius+1)*(2*radius+1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			window = window[:0]
+			for yy := max(0, y-radius); yy <= min(h-1, y+radius); yy++ {
+				for xx := max(0, x-radius); xx <= min(w-1, x+radius); xx++ {
+					window = append(window, gray.Pix[yy*gray.Stride+xx])
+				}
+			}
+			out.Pix[y*out.Stride+x] = pick(window)
+		}
+	}
+	return out
+}
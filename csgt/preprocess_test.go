@@ -0,0 +1,203 @@
+package csgt
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// grayImage builds a w×h grayscale image from rows of pixel values.
+func grayImage(rows ...[]uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		copy(img.Pix[y*img.Stride:], row)
+	}
+	return img
+}
+
+// grayRows returns the pixel values of img row by row.
+func grayRows(img image.Image) [][]uint8 {
+	gray := toGray(img)
+	rows := make([][]uint8, gray.Rect.Dy())
+	for y := range rows {
+		rows[y] = append([]uint8(nil), gray.Pix[y*gray.Stride:y*gray.Stride+gray.Rect.Dx()]...)
+	}
+	return rows
+}
+
+func equalRows(a, b [][]uint8) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for y := range a {
+		if string(a[y]) != string(b[y]) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustPipeline(t *testing.T, spec string) Pipeline {
+	t.Helper()
+	p, err := ParsePipeline("test", spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParsePipeline(t *testing.T) {
+	p, err := ParsePipeline("otsu", " grayscale, threshold ,median:3,,crop:1:2:3:4 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "otsu" || len(p.steps) != 4 || p.String() != " grayscale, threshold ,median:3,,crop:1:2:3:4 " {
+		t.Errorf("pipeline = %+v, want 4 steps named otsu", p)
+	}
+	if d := DefaultPipeline(); d.Name != "default" || d.String() != DefaultPreprocessing {
+		t.Errorf("DefaultPipeline = %+v", d)
+	}
+
+	for _, spec := range []string{
+		"",
+		" , ",
+		"sharpen",
+		"grayscale:1",
+		"contrast",
+		"contrast:101",
+		"threshold:256",
+		"threshold:1:2",
+		"threshold:x",
+		"median:4",
+		"median:1",
+		"upscale:9",
+		"dilate:0",
+		"erode:11",
+		"crop:1:2",
+		"crop:-1",
+		"invert:1",
+	} {
+		if _, err := ParsePipeline("bad", spec); err == nil {
+			t.Errorf("ParsePipeline(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestParsePipelines(t *testing.T) {
+	pipelines, err := ParsePipelines("plain=grayscale,contrast:20; grayscale,threshold ;; otsu = grayscale,threshold,median:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range pipelines {
+		names = append(names, p.Name)
+	}
+	if len(names) != 3 || names[0] != "plain" || names[1] != "v2" || names[2] != "otsu" {
+		t.Errorf("names = %v, want [plain v2 otsu]", names)
+	}
+
+	for _, spec := range []string{"", " ; ", "a=grayscale; a=invert", "a=", "a=grayscale; b=sharpen"} {
+		if _, err := ParsePipelines(spec); err == nil {
+			t.Errorf("ParsePipelines(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestPreprocessSteps(t *testing.T) {
+	speck := grayImage(
+		[]uint8{255, 255, 255, 255, 255},
+		[]uint8{255, 255, 255, 255, 255},
+		[]uint8{255, 255, 0, 255, 255},
+		[]uint8{255, 255, 255, 255, 255},
+		[]uint8{255, 255, 255, 255, 255},
+	)
+	white := grayRows(image.NewGray(speck.Rect))
+	for _, row := range white {
+		for x := range row {
+			row[x] = 255
+		}
+	}
+	tests := []struct {
+		spec string
+		in   *image.Gray
+		want [][]uint8
+	}{
+		{"threshold:150", grayImage([]uint8{100, 150, 151, 200}), [][]uint8{{0, 0, 255, 255}}},
+		{"threshold", grayImage([]uint8{10, 20, 30, 220, 230, 240}), [][]uint8{{0, 0, 0, 255, 255, 255}}},
+		{"invert", grayImage([]uint8{0, 255, 100}), [][]uint8{{255, 0, 155}}},
+		{"median:3", speck, white}, // every window around the speck is mostly white
+		{"dilate:1", speck, [][]uint8{
+			{255, 255, 255, 255, 255},
+			{255, 0, 0, 0, 255},
+			{255, 0, 0, 0, 255},
+			{255, 0, 0, 0, 255},
+			{255, 255, 255, 255, 255},
+		}},
+		{"erode:1", speck, white},
+		{"crop:1:2:0:1", speck, [][]uint8{
+			{255, 255},
+			{255, 0},
+			{255, 255},
+			{255, 255},
+		}},
+		{"crop:3", speck, grayRows(speck)}, // nothing would be left
+		{"crop:0:0:0:5", speck, grayRows(speck)},
+		{"invert,threshold:100", grayImage([]uint8{50, 200}), [][]uint8{{255, 0}}},
+	}
+	for _, tt := range tests {
+		got := grayRows(mustPipeline(t, tt.spec).Apply(tt.in))
+		if !equalRows(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestPreprocessResizesAndConverts(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+
+	up := mustPipeline(t, "upscale:3").Apply(img)
+	if b := up.Bounds(); b.Dx() != 12 || b.Dy() != 9 {
+		t.Errorf("upscale:3 of 4x3 is %dx%d, want 12x9", b.Dx(), b.Dy())
+	}
+
+	gray := mustPipeline(t, "grayscale").Apply(img)
+	r, g, b, _ := gray.At(1, 1).RGBA()
+	if r != g || g != b || r == 0xffff {
+		t.Errorf("grayscale red pixel = %d,%d,%d, want an even gray", r, g, b)
+	}
+
+	more := mustPipeline(t, "grayscale,contrast:50").Apply(img)
+	less := mustPipeline(t, "grayscale,contrast:-50").Apply(img)
+	if toGray(more).GrayAt(1, 1).Y >= toGray(less).GrayAt(1, 1).Y {
+		t.Error("more contrast did not darken the dark pixel")
+	}
+}
+
+// TestThresholdStride runs threshold over an image whose rows are shorter
+// than its stride, as a sub-image of a wider captcha is.
+func TestThresholdStride(t *testing.T) {
+	wide := grayImage(
+		[]uint8{10, 240, 0, 0, 0, 0},
+		[]uint8{240, 10, 0, 0, 0, 0},
+	)
+	sub := wide.SubImage(image.Rect(0, 0, 2, 2)).(*image.Gray)
+	if sub.Stride == sub.Rect.Dx() {
+		t.Fatal("the sub-image shares no stride with its parent")
+	}
+	for _, spec := range []string{"threshold", "threshold:128"} {
+		got := grayRows(mustPipeline(t, spec).Apply(sub))
+		if want := [][]uint8{{0, 255}, {255, 0}}; !equalRows(got, want) {
+			t.Errorf("%s: got %v, want %v", spec, got, want)
+		}
+	}
+
+	// A sub-image away from the origin is copied before thresholding.
+	offset := wide.SubImage(image.Rect(1, 0, 3, 2))
+	if got := grayRows(mustPipeline(t, "threshold:128").Apply(offset)); !equalRows(got, [][]uint8{{255, 0}, {0, 0}}) {
+		t.Errorf("offset sub-image: got %v", got)
+	}
+}
@@ -1,7 +1,8 @@
-package main
+package csgt
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,54 +18,26 @@ import (
 	"github.com/PuerkitoBio/goquery"
 )
 
-func newSessionClient() (*http.Client, error) {
+func (c *Client) newSessionClient() (*http.Client, error) {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating cookie jar: %w", err)
 	}
-	return &http.Client{
-		Jar:     jar,
-		Timeout: 45 * time.Second, // Increased from 20s to handle high load
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 100,
-			IdleConnTimeout:     90 * time.Second,
-			DisableKeepAlives:   false,
-		},
-	}, nil
+	session := *c.httpClient
+	session.Jar = jar
+	return &session, nil
 }
 
-func checkLicensePlate(licensePlate, vehicleType string) (*SubmitFormResponse, int, error) {
-	// Apply rate limiting
-	globalRateLimiter.Wait()
-	
-	var lastErr error
-	for attempt := 1; attempt <= maxCaptchaAttempts; attempt++ {
-		result, err := performSingleAttempt(licensePlate, vehicleType)
-		if err == nil {
-			return result, attempt, nil
-		}
-		if errors.Is(err, errCaptchaMismatch) {
-			lastErr = err
-			continue
-		}
-		return nil, attempt, err
-	}
-
-	if lastErr != nil {
-		return nil, maxCaptchaAttempts, fmt.Errorf("captcha validation failed after %d attempts", maxCaptchaAttempts)
-	}
-
-	return nil, maxCaptchaAttempts, fmt.Errorf("failed to check license plate after %d attempts", maxCaptchaAttempts)
-}
-
-func performSingleAttempt(licensePlate, vehicleType string) (*SubmitFormResponse, error) {
-	client, err := newSessionClient()
+func (c *Client) performSingleAttempt(ctx context.Context, licensePlate, vehicleType string, refreshes *int) (*SubmitFormResponse, error) {
+	client, err := c.newSessionClient()
 	if err != nil {
 		return nil, err
 	}
 
-	captcha, err := solveCaptcha(client)
+	captcha, err := c.readCaptcha(ctx, client, refreshes)
+	if errors.Is(err, ErrCaptchaUnreadable) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error solving captcha: %w", err)
 	}
@@ -72,27 +45,30 @@ func performSingleAttempt(licensePlate, vehicleType string) (*SubmitFormResponse
 	data := url.Values{}
 	data.Set("BienKS", licensePlate)
 	data.Set("Xe", vehicleType)
-	data.Set("captcha", captcha)
+	data.Set("captcha", captcha.Text)
 	data.Set("ipClient", defaultIPClient)
-	data.Set("cUrl", formURL)
+	data.Set("cUrl", c.formURL())
 
-	req, err := http.NewRequest("POST", submitURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.submitURL(), strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
 	req.Header.Set("User-Agent", userAgent)
-	req.Header.Set("Referer", formURL)
+	req.Header.Set("Referer", c.formURL())
 	req.Header.Set("X-Requested-With", "XMLHttpRequest")
-	req.Header.Set("Origin", csgtURL)
+	req.Header.Set("Origin", c.baseURL)
 
+	started := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		c.observer.UpstreamRequest(ctx, StepSubmit, time.Since(started), err)
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	responseBody, err := ioutil.ReadAll(resp.Body)
+	c.observer.UpstreamRequest(ctx, StepSubmit, time.Since(started), err)
 	if err != nil {
 		return nil, fmt.Errorf("error reading response: %w", err)
 	}
@@ -105,16 +81,22 @@ func performSingleAttempt(licensePlate, vehicleType string) (*SubmitFormResponse
 		responseString := strings.TrimSpace(string(cleanBody))
 		if code, convErr := strconv.Atoi(responseString); convErr == nil {
 			if code == 404 {
-				return nil, errCaptchaMismatch
+				c.observer.CaptchaSubmitted(ctx, false)
+				c.recordCaptcha(ctx, captcha, false)
+				return nil, ErrCaptchaMismatch
 			}
 			return nil, fmt.Errorf("server returned error code: %d", code)
 		}
 		return nil, fmt.Errorf("error parsing JSON response: %w", err)
 	}
+	c.observer.CaptchaSubmitted(ctx, true)
+	c.recordCaptcha(ctx, captcha, true)
 
 	if submitResponse.Href != "" {
-		if details, err := fetchResultDetails(client, submitResponse.Href); err == nil {
+		if details, err := c.fetchResultDetails(ctx, client, submitResponse.Href); err == nil {
 			submitResponse.Details = details
+		} else if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
 		} else {
 			log.Printf("warning: unable to read result page: %v", err)
 		}
@@ -123,38 +105,63 @@ func performSingleAttempt(licensePlate, vehicleType string) (*SubmitFormResponse
 	return &submitResponse, nil
 }
 
-func fetchResultDetails(client *http.Client, href string) (*ResultDetails, error) {
+// recordCaptcha hands a submitted captcha to the recorder, if any.
+func (c *Client) recordCaptcha(ctx context.Context, captcha *solvedCaptcha, verified bool) {
+	if c.recorder == nil {
+		return
+	}
+	c.recorder.RecordCaptcha(ctx, CaptchaSample{
+		Image:      captcha.image,
+		Text:       captcha.Text,
+		Solver:     captcha.Solver,
+		Variant:    captcha.Variant,
+		Verified:   verified,
+		CapturedAt: time.Now(),
+	})
+}
+
+func (c *Client) fetchResultDetails(ctx context.Context, client *http.Client, href string) (*ResultDetails, error) {
 	if href == "" {
 		return nil, nil
 	}
 
 	// Retry logic with exponential backoff
-	maxRetries := 3
+	maxRetries := c.resultRetries
 	var lastErr error
 	
 	for retry := 0; retry < maxRetries; retry++ {
 		if retry > 0 {
 			// Exponential backoff: 1s, 2s, 4s
 			backoff := time.Duration(1<<uint(retry-1)) * time.Second
-			time.Sleep(backoff)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
 			log.Printf("Retrying fetchResultDetails (attempt %d/%d) for: %s", retry+1, maxRetries, href)
+			c.observer.ResultRetry(ctx)
 		}
 		
-		req, err := http.NewRequest("GET", href, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", href, nil)
 		if err != nil {
 			return nil, fmt.Errorf("error creating result request: %w", err)
 		}
 		req.Header.Set("User-Agent", userAgent)
-		req.Header.Set("Referer", formURL)
+		req.Header.Set("Referer", c.formURL())
 
+		started := time.Now()
 		resp, err := client.Do(req)
 		if err != nil {
+			c.observer.UpstreamRequest(ctx, StepResult, time.Since(started), err)
 			lastErr = fmt.Errorf("error fetching result page: %w", err)
 			continue // Retry on error
 		}
 		defer resp.Body.Close()
 
 		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		c.observer.UpstreamRequest(ctx, StepResult, time.Since(started), err)
 		if err != nil {
 			lastErr = fmt.Errorf("error reading result page: %w", err)
 			continue // Retry on error
@@ -0,0 +1,315 @@
+package csgt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errNoText is reported when a solver succeeds without reading anything.
+var errNoText = errors.New("no text detected")
+
+// CaptchaSolver reads the text out of a preprocessed captcha image.
+type CaptchaSolver interface {
+	Name() string
+	Solve(ctx context.Context, img image.Image) (string, error)
+}
+
+// SolverFunc adapts a plain function to the CaptchaSolver interface.
+type SolverFunc func(ctx context.Context, img image.Image) (string, error)
+
+// Name implements CaptchaSolver.
+func (f SolverFunc) Name() string {
+	return "func"
+}
+
+// Solve implements CaptchaSolver.
+func (f SolverFunc) Solve(ctx context.Context, img image.Image) (string, error) {
+	return f(ctx, img)
+}
+
+// SolverConfig describes one entry of a solver chain.
+type SolverConfig struct {
+	Name    string            `json:"name"`
+	Timeout Duration          `json:"timeout,omitempty"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// Duration is a time.Duration that reads from JSON strings such as "5s".
+type Duration time.Duration
+
+// UnmarshalJSON accepts either a duration string or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		*d = Duration(parsed)
+		return nil
+	}
+
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("duration: cannot parse %s", string(data))
+	}
+	*d = Duration(n)
+	return nil
+}
+
+// MarshalJSON writes the duration in its string form.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// SolverFactory builds a solver from its chain entry.
+type SolverFactory func(cfg SolverConfig) (CaptchaSolver, error)
+
+var (
+	solverRegistryMu sync.RWMutex
+	solverRegistry   = make(map[string]SolverFactory)
+)
+
+// RegisterSolver makes a solver available to NewSolver under name.
+// Registering the same name twice replaces the earlier factory.
+func RegisterSolver(name string, factory SolverFactory) {
+	solverRegistryMu.Lock()
+	defer solverRegistryMu.Unlock()
+	solverRegistry[strings.ToLower(name)] = factory
+}
+
+// RegisteredSolvers returns the sorted names of all registered solvers.
+func RegisteredSolvers() []string {
+	solverRegistryMu.RLock()
+	defer solverRegistryMu.RUnlock()
+
+	names := make([]string, 0, len(solverRegistry))
+	for name := range solverRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSolver builds the registered solver named by cfg, bounded by its timeout.
+func NewSolver(cfg SolverConfig) (CaptchaSolver, error) {
+	solverRegistryMu.RLock()
+	factory, ok := solverRegistry[strings.ToLower(cfg.Name)]
+	solverRegistryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown captcha solver %q (registered: %s)", cfg.Name, strings.Join(RegisteredSolvers(), ", "))
+	}
+
+	solver, err := factory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating captcha solver %q: %w", cfg.Name, err)
+	}
+	if cfg.Timeout > 0 {
+		solver = WithSolverTimeout(solver, time.Duration(cfg.Timeout))
+	}
+	return solver, nil
+}
+
+type timeoutSolver struct {
+	CaptchaSolver
+	timeout time.Duration
+}
+
+// WithSolverTimeout bounds every Solve call of solver by timeout.
+func WithSolverTimeout(solver CaptchaSolver, timeout time.Duration) CaptchaSolver {
+	return &timeoutSolver{CaptchaSolver: solver, timeout: timeout}
+}
+
+func (s *timeoutSolver) Solve(ctx context.Context, img image.Image) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.CaptchaSolver.Solve(ctx, img)
+}
+
+func (s *timeoutSolver) SolveConfidence(ctx context.Context, img image.Image) (string, float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return solveConfidence(ctx, s.CaptchaSolver, img)
+}
+
+func (s *timeoutSolver) Remote() bool {
+	return isRemote(s.CaptchaSolver)
+}
+
+// RemoteSolver is a CaptchaSolver that may call a paid or remote service
+// when Remote reports true. Lookups run remote solvers at most once per
+// captcha instead of once per preprocessing variant; see SolveCaptcha.
+type RemoteSolver interface {
+	CaptchaSolver
+	Remote() bool
+}
+
+func isRemote(solver CaptchaSolver) bool {
+	r, ok := solver.(RemoteSolver)
+	return ok && r.Remote()
+}
+
+// splitRemote separates the remote solvers of solver, which may be a Chain,
+// from the local ones, keeping their order. Either part is nil when empty.
+func splitRemote(solver CaptchaSolver) (local, remote CaptchaSolver) {
+	chain, ok := solver.(*Chain)
+	if !ok {
+		if isRemote(solver) {
+			return nil, solver
+		}
+		return solver, nil
+	}
+
+	var locals, remotes []CaptchaSolver
+	for _, s := range chain.solvers {
+		if isRemote(s) {
+			remotes = append(remotes, s)
+		} else {
+			locals = append(locals, s)
+		}
+	}
+	if len(locals) > 0 {
+		local = NewChain(locals...)
+	}
+	if len(remotes) > 0 {
+		remote = NewChain(remotes...)
+	}
+	return local, remote
+}
+
+// Chain tries its solvers in order and returns the first non-empty result.
+type Chain struct {
+	solvers []CaptchaSolver
+}
+
+// NewChain creates a Chain from already built solvers.
+func NewChain(solvers ...CaptchaSolver) *Chain {
+	return &Chain{solvers: solvers}
+}
+
+// BuildChain creates a Chain from registered solver configs.
+func BuildChain(configs []SolverConfig) (*Chain, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("captcha solver chain is empty")
+	}
+
+	solvers := make([]CaptchaSolver, 0, len(configs))
+	for _, cfg := range configs {
+		solver, err := NewSolver(cfg)
+		if err != nil {
+			return nil, err
+		}
+		solvers = append(solvers, solver)
+	}
+	return NewChain(solvers...), nil
+}
+
+// Name implements CaptchaSolver.
+func (ch *Chain) Name() string {
+	names := make([]string, len(ch.solvers))
+	for i, solver := range ch.solvers {
+		names[i] = solver.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Solve implements CaptchaSolver.
+func (ch *Chain) Solve(ctx context.Context, img image.Image) (string, error) {
+	text, _, _, err := ch.solve(ctx, img)
+	return text, err
+}
+
+// SolveConfidence implements ConfidenceSolver.
+func (ch *Chain) SolveConfidence(ctx context.Context, img image.Image) (string, float64, error) {
+	text, _, confidence, err := ch.solve(ctx, img)
+	return text, confidence, err
+}
+
+// solve is Solve that also returns the name of the solver that read the
+// text and its confidence.
+func (ch *Chain) solve(ctx context.Context, img image.Image) (string, string, float64, error) {
+	var lastErr error
+	for _, solver := range ch.solvers {
+		if err := ctx.Err(); err != nil {
+			return "", "", 0, err
+		}
+
+		started := time.Now()
+		text, confidence, err := solveConfidence(ctx, solver, img)
+		if err == nil && text == "" {
+			err = errNoText
+		}
+		observerFrom(ctx).SolverAttempt(ctx, solver.Name(), time.Since(started), err)
+		if err == nil {
+			log.Printf("%s OCR succeeded: %s", solver.Name(), text)
+			return text, solver.Name(), confidence, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", "", 0, ctxErr
+		}
+		log.Printf("%s failed (%v), trying next solver...", solver.Name(), err)
+		lastErr = fmt.Errorf("%s: %w", solver.Name(), err)
+	}
+
+	if lastErr == nil {
+		return "", "", 0, fmt.Errorf("no captcha solvers configured")
+	}
+	return "", "", 0, fmt.Errorf("all OCR methods failed: %w", lastErr)
+}
+
+// ParseSolverSpec reads a chain such as "tesseract:5s,ocrspace" where each
+// entry may carry its own timeout after a colon.
+func ParseSolverSpec(spec string) ([]SolverConfig, error) {
+	var configs []SolverConfig
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		cfg := SolverConfig{Name: entry}
+		if name, timeout, ok := strings.Cut(entry, ":"); ok {
+			d, err := time.ParseDuration(strings.TrimSpace(timeout))
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout for solver %q: %w", name, err)
+			}
+			cfg.Name = strings.TrimSpace(name)
+			cfg.Timeout = Duration(d)
+		}
+		configs = append(configs, cfg)
+	}
+
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("captcha solver chain is empty")
+	}
+	return configs, nil
+}
+
+// LoadSolverConfigFile reads a JSON chain definition of the form
+// {"solvers": [{"name": "tesseract", "timeout": "5s"}, ...]}.
+func LoadSolverConfigFile(path string) ([]SolverConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading solver config: %w", err)
+	}
+
+	var file struct {
+		Solvers []SolverConfig `json:"solvers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing solver config: %w", err)
+	}
+	if len(file.Solvers) == 0 {
+		return nil, fmt.Errorf("solver config %s lists no solvers", path)
+	}
+	return file.Solvers, nil
+}
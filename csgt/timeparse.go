@@ -0,0 +1,59 @@
+package csgt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// violationTimeLayouts are the forms CSGT prints violation times in, most
+// common first.
+var violationTimeLayouts = []string{
+	"15:04, 02/01/2006",
+	"15:04:05, 02/01/2006",
+	"15:04 02/01/2006",
+	"15:04:05 02/01/2006",
+	"02/01/2006 15:04",
+	"02/01/2006 15:04:05",
+}
+
+// Location is the zone CSGT times are reported in. Vietnam has no daylight
+// saving time, so a fixed +07:00 zone is used when tzdata is unavailable.
+var Location = loadLocation()
+
+func loadLocation() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Ho_Chi_Minh"); err == nil {
+		return loc
+	}
+	return time.FixedZone("ICT", 7*60*60)
+}
+
+// ParseViolationTime parses a violation time such as "08:44, 16/10/2025" in
+// the Asia/Ho_Chi_Minh zone.
+func ParseViolationTime(s string) (time.Time, error) {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.ReplaceAll(s, " ,", ",")
+	for _, layout := range violationTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, Location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized violation time %q", s)
+}
+
+// parseViolationTimes fills the structured time of each violation, recording
+// why it could not be parsed instead of dropping it silently.
+func parseViolationTimes(violations []Violation) {
+	for i := range violations {
+		v := &violations[i]
+		if v.ViolationTime == "" {
+			continue
+		}
+		t, err := ParseViolationTime(v.ViolationTime)
+		if err != nil {
+			v.ViolationTimeError = err.Error()
+			continue
+		}
+		v.ViolatedAt = &t
+	}
+}
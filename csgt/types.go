@@ -0,0 +1,106 @@
+package csgt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type ocrSpaceResponse struct {
+	ParsedResults []struct {
+		ParsedText string `json:"ParsedText"`
+	} `json:"ParsedResults"`
+	OCRExitCode           int    `json:"OCRExitCode"`
+	IsErroredOnProcessing bool   `json:"IsErroredOnProcessing"`
+	ErrorMessage          string `json:"ErrorMessage"`
+}
+
+type SubmitFormResponse struct {
+	Success boolish `json:"success"`
+	Href    string  `json:"href"`
+	Error   string  `json:"error"`
+	Details *ResultDetails
+
+	// CaptchaRefreshes is how many captchas the lookup downloaded again
+	// instead of submitting a read that failed the CaptchaCheck.
+	CaptchaRefreshes int `json:"-"`
+}
+
+type boolish bool
+
+type ResultDetails struct {
+	Message    string      `json:"message,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+type Violation struct {
+	// ID is the violation's Fingerprint, stable across lookups.
+	ID            string `json:"id"`
+	LicensePlate  string `json:"license_plate"`
+	PlateColor    string `json:"plate_color"`
+	VehicleType   string `json:"vehicle_type"`
+	ViolationTime string `json:"violation_time"`
+	// ViolatedAt is ViolationTime parsed in the Asia/Ho_Chi_Minh zone; when
+	// parsing fails it is nil and ViolationTimeError says why.
+	ViolatedAt         *time.Time `json:"violated_at,omitempty"`
+	ViolationTimeError string     `json:"violation_time_error,omitempty"`
+	Location           string     `json:"location"`
+	Behavior           string     `json:"behavior"`
+	// BehaviorCode is the decree reference decoded from Behavior, and Fine
+	// its penalty from the embedded fine table when the code is known.
+	BehaviorCode    *BehaviorCode `json:"behavior_code,omitempty"`
+	Fine            *Fine         `json:"fine,omitempty"`
+	Status          string        `json:"status"`
+	DetectingUnit   string        `json:"detecting_unit"`
+	ResolutionPoint string        `json:"resolution_point"`
+}
+
+func (b *boolish) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		*b = boolish(false)
+		return nil
+	}
+
+	if data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		s = strings.TrimSpace(strings.ToLower(s))
+		switch s {
+		case "true", "1", "yes", "y":
+			*b = boolish(true)
+		default:
+			*b = boolish(false)
+		}
+		return nil
+	}
+
+	var boolVal bool
+	if err := json.Unmarshal(data, &boolVal); err == nil {
+		*b = boolish(boolVal)
+		return nil
+	}
+
+	var intVal int
+	if err := json.Unmarshal(data, &intVal); err == nil {
+		*b = boolish(intVal != 0)
+		return nil
+	}
+
+	return fmt.Errorf("boolish: cannot parse %s", string(data))
+}
+
+func (b boolish) MarshalJSON() ([]byte, error) {
+	if b {
+		return []byte("true"), nil
+	}
+	return []byte("false"), nil
+}
+
+func (b boolish) Bool() bool {
+	return bool(b)
+}
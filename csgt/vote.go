@@ -0,0 +1,189 @@
+package csgt
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfidenceSolver is a CaptchaSolver that also tells how sure it is of what
+// it read, from 0 to 1. Solvers that do not implement it count as sure.
+type ConfidenceSolver interface {
+	CaptchaSolver
+	SolveConfidence(ctx context.Context, img image.Image) (string, float64, error)
+}
+
+// solveConfidence runs solver, asking for its confidence when it has one.
+func solveConfidence(ctx context.Context, solver CaptchaSolver, img image.Image) (string, float64, error) {
+	if cs, ok := solver.(ConfidenceSolver); ok {
+		return cs.SolveConfidence(ctx, img)
+	}
+	text, err := solver.Solve(ctx, img)
+	return text, 1, err
+}
+
+// Vote modes.
+const (
+	// VoteMajority picks the text most variants read.
+	VoteMajority = "majority"
+	// VoteConfidence picks the text with the highest summed confidence.
+	VoteConfidence = "confidence"
+)
+
+// ParseVoteMode checks a vote mode name; empty means VoteMajority.
+func ParseVoteMode(mode string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", VoteMajority:
+		return VoteMajority, nil
+	case VoteConfidence:
+		return VoteConfidence, nil
+	}
+	return "", fmt.Errorf("unknown vote mode %q (want %s or %s)", mode, VoteMajority, VoteConfidence)
+}
+
+// WithPreprocessing makes the client read every captcha through each of
+// pipelines in parallel and pick the answer by vote.
+func WithPreprocessing(pipelines []Pipeline, vote string) Option {
+	return func(c *Client) {
+		c.pipelines = pipelines
+		c.vote = vote
+	}
+}
+
+// Read is what a solver made of one preprocessing variant of a captcha.
+type Read struct {
+	Variant    string
+	Solver     string // the solver that produced Text; in a Chain, the one that succeeded
+	Text       string
+	Confidence float64
+	Duration   time.Duration
+	Err        error
+
+	// Votes is how many reads agreed on Text, as counted by Vote.
+	Votes int
+}
+
+// SolveCaptcha reads img the way lookups do. The local solvers of solver
+// read every pipeline's rendering of img in parallel and the reads are
+// voted on. Remote solvers (see RemoteSolver) run at most once, on the
+// first pipeline, and only when the vote is inconclusive: every local read
+// failed, or several variants were read and no text won a strict majority
+// of them. A remote read replaces the vote's winner. SolveCaptcha returns
+// the answer and every read made, the remote one last; ok is false when
+// nothing could be read.
+func SolveCaptcha(ctx context.Context, solver CaptchaSolver, pipelines []Pipeline, mode string, img image.Image) (answer Read, reads []Read, ok bool) {
+	if len(pipelines) == 0 {
+		pipelines = []Pipeline{DefaultPipeline()}
+	}
+	local, remote := splitRemote(solver)
+	if local != nil {
+		reads = SolveVariants(ctx, local, pipelines, img)
+		answer, ok = Vote(reads, mode)
+	}
+	conclusive := ok && (len(reads) == 1 || 2*answer.Votes > len(reads))
+	if remote == nil || conclusive || ctx.Err() != nil {
+		return answer, reads, ok
+	}
+
+	started := time.Now()
+	read := solveVariant(ctx, remote, pipelines[0].Apply(img))
+	read.Variant = pipelines[0].Name
+	read.Duration = time.Since(started)
+	read.Votes = 1
+	reads = append(reads, read)
+	if read.Err == nil && read.Text != "" {
+		return read, reads, true
+	}
+	return answer, reads, ok
+}
+
+// SolveVariants runs solver over each pipeline's rendering of img in
+// parallel and returns the reads in pipeline order.
+func SolveVariants(ctx context.Context, solver CaptchaSolver, pipelines []Pipeline, img image.Image) []Read {
+	reads := make([]Read, len(pipelines))
+	var wg sync.WaitGroup
+	for i, pipeline := range pipelines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started := time.Now()
+			reads[i] = solveVariant(ctx, solver, pipeline.Apply(img))
+			reads[i].Variant = pipeline.Name
+			reads[i].Duration = time.Since(started)
+		}()
+	}
+	wg.Wait()
+	return reads
+}
+
+// solveVariant reads one preprocessed image. A Chain reports each of its
+// solvers itself; any other solver is reported here.
+func solveVariant(ctx context.Context, solver CaptchaSolver, img image.Image) Read {
+	if chain, ok := solver.(*Chain); ok {
+		text, name, confidence, err := chain.solve(ctx, img)
+		return Read{Solver: name, Text: text, Confidence: confidence, Err: err}
+	}
+
+	started := time.Now()
+	text, confidence, err := solveConfidence(ctx, solver, img)
+	if err == nil && text == "" {
+		err = errNoText
+	}
+	observerFrom(ctx).SolverAttempt(ctx, solver.Name(), time.Since(started), err)
+	return Read{Solver: solver.Name(), Text: text, Confidence: confidence, Err: err}
+}
+
+// Vote picks the answer among reads. Failed reads do not vote. In
+// VoteMajority mode texts read equally often are ranked by their summed
+// confidence, in VoteConfidence mode texts of equal summed confidence by how
+// often they were read; only what is still tied goes to the text read by the
+// earliest variant. The returned read is the first one of the winning text,
+// its Confidence the mean over the reads that agree. It reports false when
+// every read failed.
+func Vote(reads []Read, mode string) (Read, bool) {
+	type tally struct {
+		first      int
+		count      int
+		confidence float64
+	}
+	tallies := make(map[string]*tally)
+	var order []string
+	for i, read := range reads {
+		if read.Err != nil || read.Text == "" {
+			continue
+		}
+		t := tallies[read.Text]
+		if t == nil {
+			t = &tally{first: i}
+			tallies[read.Text] = t
+			order = append(order, read.Text)
+		}
+		t.count++
+		t.confidence += read.Confidence
+	}
+	if len(order) == 0 {
+		return Read{}, false
+	}
+
+	better := func(a, b *tally) bool {
+		if mode == VoteConfidence {
+			return a.confidence > b.confidence || (a.confidence == b.confidence && a.count > b.count)
+		}
+		return a.count > b.count || (a.count == b.count && a.confidence > b.confidence)
+	}
+	best := order[0]
+	for _, text := range order[1:] {
+		if better(tallies[text], tallies[best]) {
+			best = text
+		}
+	}
+
+	t := tallies[best]
+	winner := reads[t.first]
+	winner.Confidence = t.confidence / float64(t.count)
+	winner.Votes = t.count
+	return winner, true
+}
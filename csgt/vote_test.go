@@ -0,0 +1,165 @@
+package csgt
+
+import (
+	"context"
+	"errors"
+	"image"
+	"sync/atomic"
+	"testing"
+)
+
+func TestVote(t *testing.T) {
+	failed := errors.New("unreadable")
+	tests := []struct {
+		name       string
+		mode       string
+		reads      []Read
+		want       string
+		variant    string
+		votes      int
+		confidence float64
+		ok         bool
+	}{
+		{
+			name:  "every read failed",
+			mode:  VoteMajority,
+			reads: []Read{{Variant: "a", Err: failed}, {Variant: "b", Text: ""}},
+		},
+		{
+			name:  "single read",
+			mode:  VoteMajority,
+			reads: []Read{{Variant: "a", Text: "k7mxpa", Confidence: 0.4}},
+			want:  "k7mxpa", variant: "a", votes: 1, confidence: 0.4, ok: true,
+		},
+		{
+			name: "majority",
+			mode: VoteMajority,
+			reads: []Read{
+				{Variant: "a", Text: "k7mxpa", Confidence: 0.9},
+				{Variant: "b", Text: "k7mxqa", Confidence: 0.5},
+				{Variant: "c", Text: "k7mxqa", Confidence: 0.3},
+			},
+			want: "k7mxqa", variant: "b", votes: 2, confidence: 0.4, ok: true,
+		},
+		{
+			name: "failed reads do not vote",
+			mode: VoteMajority,
+			reads: []Read{
+				{Variant: "a", Text: "k7mxpa", Err: failed},
+				{Variant: "b", Text: "k7mxpa", Err: failed},
+				{Variant: "c", Text: "k7mxqa", Confidence: 0.3},
+			},
+			want: "k7mxqa", variant: "c", votes: 1, confidence: 0.3, ok: true,
+		},
+		{
+			name: "majority tie broken by confidence",
+			mode: VoteMajority,
+			reads: []Read{
+				{Variant: "a", Text: "k7mxpa", Confidence: 0.2},
+				{Variant: "b", Text: "k7mxqa", Confidence: 0.6},
+			},
+			want: "k7mxqa", variant: "b", votes: 1, confidence: 0.6, ok: true,
+		},
+		{
+			name: "full tie goes to the earliest variant",
+			mode: VoteMajority,
+			reads: []Read{
+				{Variant: "a", Text: "k7mxpa", Confidence: 0.5},
+				{Variant: "b", Text: "k7mxqa", Confidence: 0.5},
+			},
+			want: "k7mxpa", variant: "a", votes: 1, confidence: 0.5, ok: true,
+		},
+		{
+			name: "confidence outweighs count",
+			mode: VoteConfidence,
+			reads: []Read{
+				{Variant: "a", Text: "k7mxpa", Confidence: 0.3},
+				{Variant: "b", Text: "k7mxpa", Confidence: 0.3},
+				{Variant: "c", Text: "k7mxqa", Confidence: 0.9},
+			},
+			want: "k7mxqa", variant: "c", votes: 1, confidence: 0.9, ok: true,
+		},
+		{
+			name: "confidence tie broken by count",
+			mode: VoteConfidence,
+			reads: []Read{
+				{Variant: "a", Text: "k7mxqa", Confidence: 0.5},
+				{Variant: "b", Text: "k7mxpa", Confidence: 0.25},
+				{Variant: "c", Text: "k7mxpa", Confidence: 0.25},
+			},
+			want: "k7mxpa", variant: "b", votes: 2, confidence: 0.25, ok: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Vote(tt.reads, tt.mode)
+			if ok != tt.ok {
+				t.Fatalf("Vote ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got.Text != tt.want || got.Variant != tt.variant || got.Votes != tt.votes || got.Confidence != tt.confidence {
+				t.Errorf("Vote = %q from %q with %d votes at %g, want %q from %q with %d votes at %g",
+					got.Text, got.Variant, got.Votes, got.Confidence, tt.want, tt.variant, tt.votes, tt.confidence)
+			}
+		})
+	}
+}
+
+// remoteStub is a remote solver counting its calls.
+type remoteStub struct {
+	text  string
+	calls atomic.Int32
+}
+
+func (s *remoteStub) Name() string { return "remote" }
+func (s *remoteStub) Remote() bool { return true }
+
+func (s *remoteStub) Solve(context.Context, image.Image) (string, error) {
+	s.calls.Add(1)
+	return s.text, nil
+}
+
+func TestSolveCaptchaRemoteFallback(t *testing.T) {
+	pipelines, err := ParsePipelines("a=grayscale; b=grayscale,invert; c=grayscale,threshold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+
+	tests := []struct {
+		name   string
+		local  []string // texts the local solver returns, one per variant; "" fails
+		want   string
+		remote int32
+	}{
+		{"majority agrees", []string{"k7mxpa", "k7mxpa", "k7mxqa"}, "k7mxpa", 0},
+		{"no majority", []string{"k7mxpa", "k7mxqa", "k7mxra"}, "remote", 1},
+		{"every read fails", []string{"", "", ""}, "remote", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n atomic.Int32
+			local := SolverFunc(func(context.Context, image.Image) (string, error) {
+				text := tt.local[int(n.Add(1)-1)%len(tt.local)]
+				if text == "" {
+					return "", errors.New("unreadable")
+				}
+				return text, nil
+			})
+			remote := &remoteStub{text: "remote"}
+
+			answer, reads, ok := SolveCaptcha(context.Background(), NewChain(local, remote), pipelines, VoteMajority, img)
+			if !ok || answer.Text != tt.want {
+				t.Errorf("SolveCaptcha = %q, %v; want %q", answer.Text, ok, tt.want)
+			}
+			if got := remote.calls.Load(); got != tt.remote {
+				t.Errorf("remote solver called %d times, want %d", got, tt.remote)
+			}
+			if want := len(pipelines) + int(tt.remote); len(reads) != want {
+				t.Errorf("got %d reads, want %d", len(reads), want)
+			}
+		})
+	}
+}
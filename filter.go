@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"LicensePlatecheck/csgt"
+)
+
+// violationFilter narrows and orders the violations returned to a client.
+type violationFilter struct {
+	since       *time.Time
+	until       *time.Time
+	newestFirst bool
+}
+
+// parseFilterTime accepts RFC 3339 timestamps or plain dates. A date means the
+// start of that day in Vietnam time, or its end when endOfDay is set.
+func parseFilterTime(field, value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, csgt.Location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: want RFC 3339 or YYYY-MM-DD", field, value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return &t, nil
+}
+
+func newViolationFilter(since, until, order string) (violationFilter, error) {
+	var (
+		f   violationFilter
+		err error
+	)
+	if f.since, err = parseFilterTime("since", since, false); err != nil {
+		return f, err
+	}
+	if f.until, err = parseFilterTime("until", until, true); err != nil {
+		return f, err
+	}
+	if f.since != nil && f.until != nil && f.until.Before(*f.since) {
+		return f, fmt.Errorf("until must not be before since")
+	}
+
+	switch strings.ToLower(order) {
+	case "":
+	case "newest":
+		f.newestFirst = true
+	default:
+		return f, fmt.Errorf("invalid sort %q: want \"newest\"", order)
+	}
+	return f, nil
+}
+
+func (f violationFilter) isZero() bool {
+	return f.since == nil && f.until == nil && !f.newestFirst
+}
+
+// apply returns details with the filter applied. Cached results are shared, so
+// the input is never modified. Violations whose time could not be parsed are
+// kept, sorted last, and still carry their violation_time_error.
+func (f violationFilter) apply(details *csgt.ResultDetails) *csgt.ResultDetails {
+	if details == nil || len(details.Violations) == 0 || f.isZero() {
+		return details
+	}
+
+	filtered := make([]csgt.Violation, 0, len(details.Violations))
+	for _, v := range details.Violations {
+		if v.ViolatedAt != nil {
+			if f.since != nil && v.ViolatedAt.Before(*f.since) {
+				continue
+			}
+			if f.until != nil && v.ViolatedAt.After(*f.until) {
+				continue
+			}
+		}
+		filtered = append(filtered, v)
+	}
+
+	if f.newestFirst {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			a, b := filtered[i].ViolatedAt, filtered[j].ViolatedAt
+			if a == nil || b == nil {
+				return b == nil && a != nil
+			}
+			return a.After(*b)
+		})
+	}
+
+	result := *details
+	result.Violations = filtered
+	if len(filtered) == 0 {
+		result.Violations = nil
+		result.Message = "Không có vi phạm trong khoảng thời gian đã chọn"
+	}
+	return &result
+}
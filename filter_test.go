@@ -0,0 +1,148 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"LicensePlatecheck/csgt"
+)
+
+func TestNewViolationFilter(t *testing.T) {
+	at := func(value string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		name         string
+		since, until string
+		sort         string
+		wantSince    string // RFC 3339; empty for no bound
+		wantUntil    string
+		newestFirst  bool
+		invalid      bool
+	}{
+		{name: "no filter"},
+		{name: "dates cover whole Vietnam days", since: "2025-10-01", until: "2025-10-16",
+			wantSince: "2025-10-01T00:00:00+07:00", wantUntil: "2025-10-16T23:59:59.999999999+07:00"},
+		{name: "timestamps are used as given", since: "2025-10-01T08:00:00Z", until: "2025-10-01T16:30:00+07:00",
+			wantSince: "2025-10-01T08:00:00Z", wantUntil: "2025-10-01T16:30:00+07:00"},
+		{name: "same day", since: "2025-10-16", until: "2025-10-16",
+			wantSince: "2025-10-16T00:00:00+07:00", wantUntil: "2025-10-16T23:59:59.999999999+07:00"},
+		{name: "only until", until: "2025-10-16", wantUntil: "2025-10-16T23:59:59.999999999+07:00"},
+		{name: "newest first", sort: "Newest", newestFirst: true},
+		{name: "until before since", since: "2025-10-16", until: "2025-10-15", invalid: true},
+		{name: "garbled since", since: "16/10/2025", invalid: true},
+		{name: "garbled until", until: "yesterday", invalid: true},
+		{name: "unknown sort", sort: "oldest", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newViolationFilter(tt.since, tt.until, tt.sort)
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("got %+v, want an error", f)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, bound := range []struct {
+				name string
+				got  *time.Time
+				want string
+			}{{"since", f.since, tt.wantSince}, {"until", f.until, tt.wantUntil}} {
+				switch {
+				case bound.want == "" && bound.got != nil:
+					t.Errorf("%s = %v, want none", bound.name, bound.got)
+				case bound.want != "" && (bound.got == nil || !bound.got.Equal(at(bound.want))):
+					t.Errorf("%s = %v, want %s", bound.name, bound.got, bound.want)
+				}
+			}
+			if f.newestFirst != tt.newestFirst {
+				t.Errorf("newestFirst = %v, want %v", f.newestFirst, tt.newestFirst)
+			}
+		})
+	}
+}
+
+func TestViolationFilterApply(t *testing.T) {
+	violation := func(behavior, at string) csgt.Violation {
+		v := csgt.Violation{Behavior: behavior}
+		if at != "" {
+			parsed, err := time.ParseInLocation("2006-01-02 15:04", at, csgt.Location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.ViolatedAt = &parsed
+		} else {
+			v.ViolationTimeError = "unparsable"
+		}
+		return v
+	}
+	details := &csgt.ResultDetails{Violations: []csgt.Violation{
+		violation("first of october", "2025-10-01 00:00"),
+		violation("mid october", "2025-10-10 12:30"),
+		violation("unknown time", ""),
+		violation("end of october 16", "2025-10-16 23:59"),
+		violation("october 17", "2025-10-17 00:00"),
+	}}
+
+	tests := []struct {
+		name         string
+		since, until string
+		sort         string
+		want         []string
+	}{
+		{name: "no filter", want: []string{"first of october", "mid october", "unknown time", "end of october 16", "october 17"}},
+		{name: "bounds are inclusive", since: "2025-10-01", until: "2025-10-16",
+			want: []string{"first of october", "mid october", "unknown time", "end of october 16"}},
+		{name: "exact timestamps are inclusive", since: "2025-10-10T12:30:00+07:00", until: "2025-10-17T00:00:00+07:00",
+			want: []string{"mid october", "unknown time", "end of october 16", "october 17"}},
+		{name: "newest first, unknown times last", sort: "newest",
+			want: []string{"october 17", "end of october 16", "mid october", "first of october", "unknown time"}},
+		{name: "nothing in range keeps unknown times", since: "2025-11-01",
+			want: []string{"unknown time"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newViolationFilter(tt.since, tt.until, tt.sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := f.apply(details)
+			var behaviors []string
+			for _, v := range got.Violations {
+				behaviors = append(behaviors, v.Behavior)
+			}
+			if len(behaviors) != len(tt.want) {
+				t.Fatalf("got %q, want %q", behaviors, tt.want)
+			}
+			for i := range behaviors {
+				if behaviors[i] != tt.want[i] {
+					t.Fatalf("got %q, want %q", behaviors, tt.want)
+				}
+			}
+		})
+	}
+	if len(details.Violations) != 5 || details.Violations[0].Behavior != "first of october" {
+		t.Error("apply modified the shared result")
+	}
+}
+
+func TestViolationFilterApplyEmptyRange(t *testing.T) {
+	at := time.Date(2025, 10, 16, 8, 44, 0, 0, csgt.Location)
+	details := &csgt.ResultDetails{Violations: []csgt.Violation{{Behavior: "speeding", ViolatedAt: &at}}}
+	f, err := newViolationFilter("2025-10-17", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := f.apply(details)
+	if got.Violations != nil || got.Message == "" {
+		t.Errorf("got %+v, want no violations and a message", got)
+	}
+}
@@ -1,33 +1,55 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strings"
 )
 
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (for proxies/load balancers)
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		// Get first IP in the chain
-		ips := strings.Split(forwarded, ",")
-		return strings.TrimSpace(ips[0])
+// lookupErrorStatus maps a lookup error to the HTTP status returned to the client.
+func lookupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, errRateLimited), errors.Is(err, errQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, context.Canceled):
+		// Client went away; nobody will read this status.
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
 	}
-	
-	// Check X-Real-IP header
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
+}
+
+// writeLookupError answers a failed lookup, adding rate limit headers when
+// a limiter or quota rejected it.
+func writeLookupError(w http.ResponseWriter, err error) {
+	var rlErr *rateLimitError
+	if errors.As(err, &rlErr) {
+		writeRateLimited(w, rlErr)
+		return
+	}
+	var qErr *quotaError
+	if errors.As(err, &qErr) {
+		writeQuotaExceeded(w, qErr)
+		return
 	}
-	
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	// Remove port if present
-	if colon := strings.LastIndex(ip, ":"); colon != -1 {
-		ip = ip[:colon]
+	http.Error(w, err.Error(), lookupErrorStatus(err))
+}
+
+// limitRequest applies per-key or per-IP rate limiting to r. It returns the
+// context the rest of the request should use, or false after answering the
+// request itself when the caller is over the limit.
+func limitRequest(w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	ctx := rateLimitContext(r.Context())
+	limiter, name := requestLimiter(r)
+	if err := waitForToken(ctx, limiter, name); err != nil {
+		writeLookupError(w, err)
+		return nil, false
 	}
-	return ip
+	setRateLimitHeaders(w, limiter)
+	return ctx, true
 }
 
 func licensePlateHandler(w http.ResponseWriter, r *http.Request) {
@@ -36,42 +58,47 @@ func licensePlateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Apply per-IP rate limiting
-	clientIP := getClientIP(r)
-	limiter := ipRateLimiter.GetLimiter(clientIP)
-	limiter.Wait()
-
-	var requestData struct {
-		LicensePlate string `json:"license_plate"`
-		VehicleType  string `json:"vehicle_type"`
+	// Apply per-key or per-IP rate limiting
+	ctx, ok := limitRequest(w, r)
+	if !ok {
+		return
 	}
 
+	var requestData lookupRequest
+
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	result, attempts, err := checkLicensePlate(requestData.LicensePlate, requestData.VehicleType)
+	licensePlate, err := requestData.parsedPlate()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	filter, err := requestData.violationFilter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := consumeQuota(ctx); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+
+	if lookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lookupTimeout)
+		defer cancel()
+	}
 
-	response := struct {
-		Success        bool           `json:"success"`
-		Href           string         `json:"href"`
-		Error          string         `json:"error"`
-		Attempts       int            `json:"attempts"`
-		ViolationCount int            `json:"violation_count"`
-		Details        *ResultDetails `json:"details,omitempty"`
-	}{
-		Success:        result.Success.Bool(),
-		Href:           result.Href,
-		Error:          result.Error,
-		Attempts:       attempts,
-		ViolationCount: getViolationCount(result.Details),
-		Details:        result.Details,
+	outcome, err := lookupLicensePlate(ctx, licensePlate, requestData.VehicleType, requestData.ForceRefresh)
+	if err != nil {
+		writeLookupError(w, err)
+		return
 	}
+	response := newLookupResponse(licensePlate, outcome, filter)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
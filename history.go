@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/plate"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultDBPath = "phatnguoi.db"
+
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// lookupsBucket holds one nested bucket per compact plate, keyed by a
+// big-endian sequence number so records iterate in the order they were saved.
+var lookupsBucket = []byte("lookups")
+
+// historyStore saves every upstream lookup; it is built in main.
+var historyStore *HistoryStore
+
+// lookupRecord is one saved upstream lookup.
+type lookupRecord struct {
+	Plate       string              `json:"plate"`
+	VehicleType string              `json:"vehicle_type"`
+	CheckedAt   time.Time           `json:"checked_at"`
+	Attempts    int                 `json:"attempts"`
+	Success     bool                `json:"success"`
+	Href        string              `json:"href"`
+	Error       string              `json:"error,omitempty"`
+	Details     *csgt.ResultDetails `json:"details,omitempty"`
+}
+
+// openDatabase opens the embedded database shared by the history and
+// watchlist stores, creating it when missing.
+func openDatabase(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening database %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// HistoryStore keeps the result of every upstream lookup per plate.
+type HistoryStore struct {
+	db *bolt.DB
+}
+
+// NewHistoryStore prepares db for lookup history.
+func NewHistoryStore(db *bolt.DB) (*HistoryStore, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(lookupsBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error preparing history store: %w", err)
+	}
+	return &HistoryStore{db: db}, nil
+}
+
+// Record saves one lookup under its compact plate.
+func (s *HistoryStore) Record(record lookupRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding lookup record: %w", err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		plates, err := tx.Bucket(lookupsBucket).CreateBucketIfNotExists([]byte(record.Plate))
+		if err != nil {
+			return fmt.Errorf("error creating history for %s: %w", record.Plate, err)
+		}
+		seq, err := plates.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return plates.Put(key, value)
+	})
+}
+
+// History returns the saved lookups of a compact plate, oldest first.
+func (s *HistoryStore) History(compactPlate string) ([]lookupRecord, error) {
+	var records []lookupRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		plates := tx.Bucket(lookupsBucket).Bucket([]byte(compactPlate))
+		if plates == nil {
+			return nil
+		}
+		return plates.ForEach(func(_, value []byte) error {
+			var record lookupRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return fmt.Errorf("error decoding lookup record: %w", err)
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Latest returns the newest saved lookup of a compact plate and vehicle type
+// that read the result page, or nil when there is none.
+func (s *HistoryStore) Latest(compactPlate, vehicleType string) (*lookupRecord, error) {
+	var latest *lookupRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		plates := tx.Bucket(lookupsBucket).Bucket([]byte(compactPlate))
+		if plates == nil {
+			return nil
+		}
+		c := plates.Cursor()
+		for _, value := c.Last(); value != nil; _, value = c.Prev() {
+			var record lookupRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return fmt.Errorf("error decoding lookup record: %w", err)
+			}
+			if record.VehicleType != vehicleType || !record.Success {
+				continue
+			}
+			if record.Href != "" && record.Details == nil {
+				continue
+			}
+			latest = &record
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// recordLookup saves a finished upstream lookup, logging rather than failing
+// when the store is unavailable.
+func recordLookup(licensePlate, vehicleType string, result *csgt.SubmitFormResponse, attempts int) {
+	if historyStore == nil || result == nil {
+		return
+	}
+	record := lookupRecord{
+		Plate:       licensePlate,
+		VehicleType: vehicleType,
+		CheckedAt:   time.Now(),
+		Attempts:    attempts,
+		Success:     result.Success.Bool(),
+		Href:        result.Href,
+		Error:       result.Error,
+		Details:     result.Details,
+	}
+	if err := historyStore.Record(record); err != nil {
+		log.Printf("history: error saving lookup of %s: %v", licensePlate, err)
+	}
+}
+
+// violationID returns the fingerprint of v. Records saved before violations
+// carried an ID get theirs computed on the fly.
+func violationID(v csgt.Violation) string {
+	if v.ID != "" {
+		return v.ID
+	}
+	return csgt.Fingerprint(v)
+}
+
+// violationTimeline is a violation with the lookups it appeared in.
+type violationTimeline struct {
+	csgt.Violation
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	TimesSeen int       `json:"times_seen"`
+}
+
+// buildTimelines merges the violations of records, oldest first, keeping the
+// latest version of each violation.
+func buildTimelines(records []lookupRecord) []violationTimeline {
+	byID := make(map[string]*violationTimeline)
+	var order []string
+	for _, record := range records {
+		if record.Details == nil {
+			continue
+		}
+		for _, v := range record.Details.Violations {
+			id := violationID(v)
+			timeline, ok := byID[id]
+			if !ok {
+				timeline = &violationTimeline{FirstSeen: record.CheckedAt}
+				byID[id] = timeline
+				order = append(order, id)
+			}
+			timeline.Violation = v
+			timeline.ID = id
+			timeline.LastSeen = record.CheckedAt
+			timeline.TimesSeen++
+		}
+	}
+
+	timelines := make([]violationTimeline, len(order))
+	for i, id := range order {
+		timelines[i] = *byID[id]
+	}
+	return timelines
+}
+
+// historyLookup is one past lookup in a history response.
+type historyLookup struct {
+	lookupRecord
+	ViolationCount int `json:"violation_count"`
+}
+
+// historyResponse is the answer of GET /plates/{plate}/history.
+type historyResponse struct {
+	Plate      plate.Plate         `json:"plate"`
+	Total      int                 `json:"total"`
+	Lookups    []historyLookup     `json:"lookups"`
+	Violations []violationTimeline `json:"violations"`
+}
+
+// plateHistoryHandler lists past lookups of a plate, newest first, and when
+// each violation first and last appeared. ?limit= caps the lookups listed;
+// the violation timeline always covers the whole history.
+func plateHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := plate.Parse(r.PathValue("plate"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxHistoryLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, err := historyStore.History(p.Compact())
+	if err != nil {
+		log.Printf("history: error reading %s: %v", p.Compact(), err)
+		http.Error(w, "Error reading history", http.StatusInternalServerError)
+		return
+	}
+
+	response := historyResponse{
+		Plate:      p,
+		Total:      len(records),
+		Lookups:    []historyLookup{},
+		Violations: buildTimelines(records),
+	}
+	sort.SliceStable(response.Violations, func(i, j int) bool {
+		return response.Violations[i].LastSeen.After(response.Violations[j].LastSeen)
+	})
+	for i := len(records) - 1; i >= 0 && len(response.Lookups) < limit; i-- {
+		response.Lookups = append(response.Lookups, historyLookup{
+			lookupRecord:   records[i],
+			ViolationCount: getViolationCount(records[i].Details),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
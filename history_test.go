@@ -0,0 +1,123 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"LicensePlatecheck/csgt"
+)
+
+func newTestHistoryStore(t *testing.T) *HistoryStore {
+	t.Helper()
+	db, err := openDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := NewHistoryStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestHistoryStoreRecord(t *testing.T) {
+	store := newTestHistoryStore(t)
+	base := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	for i, p := range []string{"98B378578", "30A12345", "98B378578"} {
+		if err := store.Record(lookupRecord{Plate: p, VehicleType: "2", CheckedAt: base.Add(time.Duration(i) * time.Hour), Success: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := store.History("98B378578")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || !records[0].CheckedAt.Equal(base) || !records[1].CheckedAt.Equal(base.Add(2*time.Hour)) {
+		t.Errorf("History = %+v, want the plate's two lookups oldest first", records)
+	}
+	if records, err := store.History("51F12345"); err != nil || records != nil {
+		t.Errorf("History of an unknown plate = %v, %v; want nothing", records, err)
+	}
+}
+
+func TestHistoryStoreLatest(t *testing.T) {
+	store := newTestHistoryStore(t)
+	details := &csgt.ResultDetails{Violations: []csgt.Violation{{Behavior: "speeding"}}}
+	records := []lookupRecord{
+		{Attempts: 1, VehicleType: "2", Success: true, Href: "https://csgt.vn/1", Details: details},
+		{Attempts: 2, VehicleType: "2", Success: true},                            // no violations, no result page
+		{Attempts: 3, VehicleType: "1", Success: true, Href: "https://csgt.vn/3"}, // other vehicle type
+		{Attempts: 4, VehicleType: "2", Success: true, Href: "https://csgt.vn/4"}, // result page not read
+		{Attempts: 5, VehicleType: "2", Error: "captcha validation failed"},       // failed
+	}
+	for _, record := range records {
+		record.Plate = "98B378578"
+		if err := store.Record(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := store.Latest("98B378578", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest == nil || latest.Attempts != 2 {
+		t.Errorf("Latest = %+v, want the lookup without violations", latest)
+	}
+
+	if err := store.Record(lookupRecord{Plate: "98B378578", VehicleType: "2", Attempts: 6, Success: true, Href: "https://csgt.vn/6", Details: details}); err != nil {
+		t.Fatal(err)
+	}
+	if latest, _ := store.Latest("98B378578", "2"); latest == nil || latest.Attempts != 6 || latest.Details == nil {
+		t.Errorf("Latest = %+v, want the newest lookup with details", latest)
+	}
+	if latest, _ := store.Latest("98B378578", "1"); latest != nil {
+		t.Errorf("Latest for vehicle type 1 = %+v, want none: its only lookup has no details", latest)
+	}
+	if latest, err := store.Latest("30A12345", "1"); err != nil || latest != nil {
+		t.Errorf("Latest of an unknown plate = %+v, %v; want nothing", latest, err)
+	}
+}
+
+func TestBuildTimelines(t *testing.T) {
+	unpaid := csgt.Violation{
+		LicensePlate:  "98B3-785.78",
+		ViolationTime: "08:44, 16/10/2025",
+		Location:      "QL1A",
+		Behavior:      "Vượt đèn đỏ",
+		Status:        "Chưa xử phạt",
+	}
+	paid := unpaid
+	paid.Status = "Đã xử phạt"
+	parking := csgt.Violation{ID: "parking", Behavior: "Đỗ xe sai quy định", Status: "Chưa xử phạt"}
+
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 8, 0, 0, 0, time.UTC) }
+	records := []lookupRecord{
+		{CheckedAt: day(1), Details: &csgt.ResultDetails{Violations: []csgt.Violation{unpaid}}},
+		{CheckedAt: day(2), Error: "captcha validation failed"},
+		{CheckedAt: day(3), Details: &csgt.ResultDetails{Violations: []csgt.Violation{parking, unpaid}}},
+		{CheckedAt: day(4), Details: &csgt.ResultDetails{Violations: []csgt.Violation{paid}}},
+	}
+
+	timelines := buildTimelines(records)
+	if len(timelines) != 2 {
+		t.Fatalf("got %d timelines, want 2: %+v", len(timelines), timelines)
+	}
+	red, park := timelines[0], timelines[1]
+	if red.ID != csgt.Fingerprint(unpaid) || red.Status != paid.Status {
+		t.Errorf("first timeline = %+v, want the red light violation, now paid", red)
+	}
+	if !red.FirstSeen.Equal(day(1)) || !red.LastSeen.Equal(day(4)) || red.TimesSeen != 3 {
+		t.Errorf("red light seen %d times from %v to %v, want 3 from day 1 to 4", red.TimesSeen, red.FirstSeen, red.LastSeen)
+	}
+	if park.ID != "parking" || !park.FirstSeen.Equal(day(3)) || !park.LastSeen.Equal(day(3)) || park.TimesSeen != 1 {
+		t.Errorf("second timeline = %+v, want parking seen once on day 3", park)
+	}
+
+	if got := buildTimelines(nil); len(got) != 0 {
+		t.Errorf("buildTimelines(nil) = %v, want none", got)
+	}
+}
@@ -0,0 +1,73 @@
+// Package fakecsgt is a stand-in for www.csgt.vn used for offline development
+// and tests.
+//
+// It serves captcha images with known answers, answers the tracuu_post AJAX
+// call the way the real site does and renders result pages with the same
+// markup, so the lookup pipeline can be exercised end to end.
+package fakecsgt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scenario selects how the fake server answers a lookup.
+type Scenario string
+
+const (
+	ScenarioNone          Scenario = "none"           // result page without violations
+	ScenarioViolations    Scenario = "violations"     // result page with several violations
+	ScenarioWrongCaptcha  Scenario = "wrong-captcha"  // reject the first submits with 404
+	ScenarioSlow          Scenario = "slow"           // delay submit and result page
+	ScenarioMalformedJSON Scenario = "malformed-json" // broken JSON from tracuu_post
+)
+
+var scenarios = []Scenario{
+	ScenarioNone,
+	ScenarioViolations,
+	ScenarioWrongCaptcha,
+	ScenarioSlow,
+	ScenarioMalformedJSON,
+}
+
+// Config says how a Server answers.
+type Config struct {
+	Scenario          Scenario            // for plates not in PlateScenarios
+	PlateScenarios    map[string]Scenario // by upper-case plate
+	CaptchaAnswer     string              // fixed captcha answer; random when empty
+	AcceptAnyCaptcha  bool                // accept every captcha text outside the wrong-captcha scenario
+	WrongCaptchaCount int                 // submits rejected per plate in the wrong-captcha scenario
+	Delay             time.Duration       // response delay in the slow scenario
+}
+
+// ParseScenario reads a scenario name such as "violations".
+func ParseScenario(s string) (Scenario, error) {
+	for _, sc := range scenarios {
+		if string(sc) == s {
+			return sc, nil
+		}
+	}
+	return "", fmt.Errorf("unknown scenario %q", s)
+}
+
+// ParsePlateScenarios reads "98B378578=violations,30A12345=none".
+func ParsePlateScenarios(spec string) (map[string]Scenario, error) {
+	result := make(map[string]Scenario)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		plate, name, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid plate scenario %q, want PLATE=SCENARIO", entry)
+		}
+		sc, err := ParseScenario(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		result[strings.ToUpper(strings.TrimSpace(plate))] = sc
+	}
+	return result, nil
+}
@@ -0,0 +1,132 @@
+package fakecsgt
+
+import "html/template"
+
+const formPage = `<!DOCTYPE html>
+<html lang="vi">
+<head><meta charset="UTF-8"><title>Tra cứu phương tiện vi phạm</title></head>
+<body>
+<form id="formBSX">
+<input name="BienKS" type="text">
+<select name="Xe"><option value="1">Ô tô</option><option value="2">Xe máy</option></select>
+<img src="/lib/captcha/captcha.class.php" alt="captcha">
+<input name="captcha" type="text">
+</form>
+</body>
+</html>`
+
+type resultViolation struct {
+	LicensePlate    string
+	PlateColor      string
+	VehicleType     string
+	ViolationTime   string
+	Location        string
+	Behavior        string
+	Status          string
+	DetectingUnit   string
+	ResolutionUnits []resolutionUnit
+}
+
+type resolutionUnit struct {
+	Name    string
+	Address string
+}
+
+type resultData struct {
+	Plate      string
+	Violations []resultViolation
+}
+
+// resultTemplate mirrors the #bodyPrint123 markup of the real result page.
+var resultTemplate = template.Must(template.New("result").Parse(`<!DOCTYPE html>
+<html lang="vi">
+<head><meta charset="UTF-8"><title>Kết quả tra cứu</title></head>
+<body>
+<div id="bodyPrint123">
+{{- if not .Violations}}
+<div class="xe_texterror">Không tìm thấy thông tin vi phạm</div>
+{{- end}}
+{{- range .Violations}}
+<div class="form-group">
+<label class="col-md-3">Biển kiểm soát:</label>
+<div class="col-md-9">{{.LicensePlate}}</div>
+</div>
+<div class="form-group">
+<label class="col-md-3">Màu biển:</label>
+<div class="col-md-9">{{.PlateColor}}</div>
+</div>
+<div class="form-group">
+<label class="col-md-3">Loại phương tiện:</label>
+<div class="col-md-9">{{.VehicleType}}</div>
+</div>
+<div class="form-group">
+<label class="col-md-3">Thời gian vi phạm:</label>
+<div class="col-md-9">{{.ViolationTime}}</div>
+</div>
+<div class="form-group">
+<label class="col-md-3">Địa điểm vi phạm:</label>
+<div class="col-md-9">{{.Location}}</div>
+</div>
+<div class="form-group">
+<label class="col-md-3">Hành vi vi phạm:</label>
+<div class="col-md-9">{{.Behavior}}</div>
+</div>
+<div class="form-group">
+<label class="col-md-3">Trạng thái:</label>
+<div class="col-md-9"><span class="badge">{{.Status}}</span></div>
+</div>
+<div class="form-group">
+<label class="col-md-3">Đơn vị phát hiện vi phạm:</label>
+<div class="col-md-9">{{.DetectingUnit}}</div>
+</div>
+<div class="form-group">
+<label class="col-md-3">Nơi giải quyết vụ việc:</label>
+<div class="col-md-9">
+{{- range $i, $unit := .ResolutionUnits}}
+<div>{{$unit.Name}}</div>
+<div>Địa chỉ: {{$unit.Address}}</div>
+{{- end}}
+</div>
+</div>
+<hr>
+{{- end}}
+</div>
+</body>
+</html>`))
+
+func sampleViolations(plate, vehicleType string) []resultViolation {
+	vehicle := "Xe máy"
+	if vehicleType == "1" {
+		vehicle = "Ô tô"
+	}
+
+	return []resultViolation{
+		{
+			LicensePlate:  plate,
+			PlateColor:    "Nền mầu trắng, chữ và số màu đen",
+			VehicleType:   vehicle,
+			ViolationTime: "08:44, 16/10/2025",
+			Location:      "Km 95+900m, QL1A, Xã Kép, Bắc Ninh",
+			Behavior:      "16824.7.2.b.01.Điều khiển xe chạy quá tốc độ quy định từ 05 km/h đến dưới 10 km/h",
+			Status:        "Chưa xử phạt",
+			DetectingUnit: "Đội Cảnh sát giao thông đường bộ số 4 - Phòng Cảnh sát giao thông - Công an Tỉnh Bắc Ninh",
+			ResolutionUnits: []resolutionUnit{
+				{Name: "1. Đội Cảnh sát giao thông đường bộ số 4 - Phòng Cảnh sát giao thông - Công an Tỉnh Bắc Ninh", Address: "Đường Xương Giang, phường Bắc Giang, tỉnh Bắc Ninh"},
+			},
+		},
+		{
+			LicensePlate:  plate,
+			PlateColor:    "Nền mầu trắng, chữ và số màu đen",
+			VehicleType:   vehicle,
+			ViolationTime: "17:05, 02/03/2025",
+			Location:      "Ngã tư Trần Duy Hưng - Hoàng Minh Giám, Cầu Giấy, Hà Nội",
+			Behavior:      "16824.7.7.c.01.Không chấp hành hiệu lệnh của đèn tín hiệu giao thông",
+			Status:        "Đã xử phạt",
+			DetectingUnit: "Đội Cảnh sát giao thông số 6 - Phòng Cảnh sát giao thông - Công an Thành phố Hà Nội",
+			ResolutionUnits: []resolutionUnit{
+				{Name: "1. Đội Cảnh sát giao thông số 6 - Phòng Cảnh sát giao thông - Công an Thành phố Hà Nội", Address: "Số 2 Phạm Văn Bạch, Cầu Giấy, Hà Nội"},
+				{Name: "2. Công an phường Yên Hòa", Address: "Số 10 Trung Kính, Yên Hòa, Hà Nội"},
+			},
+		},
+	}
+}
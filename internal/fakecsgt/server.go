@@ -0,0 +1,282 @@
+package fakecsgt
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	sessionCookie  = "PHPSESSID"
+	captchaPath    = "/lib/captcha/captcha.class.php"
+	formPath       = "/tra-cuu-phuong-tien-vi-pham.html"
+	captchaLength  = 6 // as on csgt.vn
+	captchaCharset = "abcdefghijkmnpqrstuvwxyz23456789"
+)
+
+type session struct {
+	captcha string
+	created time.Time
+}
+
+// Server is the fake csgt.vn site; serve it with Handler.
+type Server struct {
+	defaultScenario   Scenario
+	plateScenarios    map[string]Scenario
+	captchaAnswer     string
+	acceptAnyCaptcha  bool
+	wrongCaptchaCount int
+	delay             time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	rejected map[string]int
+}
+
+// NewServer creates a fake site answering as cfg says.
+func NewServer(cfg Config) *Server {
+	return &Server{
+		defaultScenario:   cfg.Scenario,
+		plateScenarios:    cfg.PlateScenarios,
+		captchaAnswer:     cfg.CaptchaAnswer,
+		acceptAnyCaptcha:  cfg.AcceptAnyCaptcha,
+		wrongCaptchaCount: cfg.WrongCaptchaCount,
+		delay:             cfg.Delay,
+		sessions:          make(map[string]*session),
+	}
+}
+
+// Handler routes the captcha, the tracuu_post call and the result page.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(captchaPath, s.handleCaptcha)
+	mux.HandleFunc(formPath, s.handleResultPage)
+	mux.HandleFunc("/", s.handleSubmit)
+	return mux
+}
+
+func (s *Server) scenarioFor(plate string) Scenario {
+	if sc, ok := s.plateScenarios[strings.ToUpper(plate)]; ok {
+		return sc
+	}
+	return s.defaultScenario
+}
+
+// sleep waits for the slow scenario delay unless the client goes away first.
+func (s *Server) sleep(r *http.Request) {
+	timer := time.NewTimer(s.delay)
+	defer timer.Stop()
+	select {
+	case <-r.Context().Done():
+	case <-timer.C:
+	}
+}
+
+func (s *Server) session(w http.ResponseWriter, r *http.Request) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if sess, ok := s.sessions[cookie.Value]; ok {
+			return sess
+		}
+	}
+
+	id := randomString(26, "abcdefghijklmnopqrstuvwxyz0123456789")
+	sess := &session{created: time.Now()}
+	s.sessions[id] = sess
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/"})
+
+	// Sessions are only needed for one captcha round trip.
+	for key, old := range s.sessions {
+		if time.Since(old.created) > 10*time.Minute {
+			delete(s.sessions, key)
+		}
+	}
+	return sess
+}
+
+func (s *Server) handleCaptcha(w http.ResponseWriter, r *http.Request) {
+	answer := s.captchaAnswer
+	if answer == "" {
+		answer = randomString(captchaLength, captchaCharset)
+	}
+
+	sess := s.session(w, r)
+	s.mu.Lock()
+	sess.captcha = answer
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("X-Captcha-Answer", answer)
+	if err := png.Encode(w, RenderCaptcha(answer)); err != nil {
+		log.Printf("error encoding captcha: %v", err)
+	}
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if r.URL.Path != "/" || query.Get("mod") != "contact" || query.Get("task") != "tracuu_post" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	plate := strings.ToUpper(strings.TrimSpace(r.PostForm.Get("BienKS")))
+	vehicleType := r.PostForm.Get("Xe")
+	captcha := strings.TrimSpace(r.PostForm.Get("captcha"))
+	scenario := s.scenarioFor(plate)
+	log.Printf("tracuu_post plate=%s xe=%s captcha=%q scenario=%s", plate, vehicleType, captcha, scenario)
+
+	if scenario == ScenarioSlow {
+		s.sleep(r)
+	}
+
+	if scenario == ScenarioWrongCaptcha && s.reject(plate) {
+		fmt.Fprint(w, "404")
+		return
+	}
+
+	if !s.acceptAnyCaptcha && !s.captchaMatches(r, captcha) {
+		fmt.Fprint(w, "404")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	if scenario == ScenarioMalformedJSON {
+		fmt.Fprint(w, `{"success":"true","href":"`)
+		return
+	}
+
+	href := fmt.Sprintf("http://%s%s?&LoaiXe=%s&BienKiemSoat=%s", r.Host, formPath,
+		url.QueryEscape(vehicleType), url.QueryEscape(plate))
+	json.NewEncoder(w).Encode(map[string]string{"success": "true", "href": href})
+}
+
+// reject reports whether this submit for plate should fail in the
+// wrong-captcha scenario, counting rejections until the next success.
+func (s *Server) reject(plate string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rejected == nil {
+		s.rejected = make(map[string]int)
+	}
+	if s.rejected[plate] < s.wrongCaptchaCount {
+		s.rejected[plate]++
+		return true
+	}
+	delete(s.rejected, plate)
+	return false
+}
+
+func (s *Server) captchaMatches(r *http.Request, captcha string) bool {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[cookie.Value]
+	if !ok || sess.captcha == "" {
+		return false
+	}
+	answer := sess.captcha
+	// Each captcha is good for a single submit.
+	sess.captcha = ""
+	return strings.EqualFold(answer, captcha)
+}
+
+func (s *Server) handleResultPage(w http.ResponseWriter, r *http.Request) {
+	plate := strings.ToUpper(r.URL.Query().Get("BienKiemSoat"))
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+
+	if plate == "" {
+		fmt.Fprint(w, formPage)
+		return
+	}
+
+	scenario := s.scenarioFor(plate)
+	if scenario == ScenarioSlow {
+		s.sleep(r)
+	}
+
+	data := resultData{Plate: plate}
+	if scenario != ScenarioNone {
+		data.Violations = sampleViolations(plate, r.URL.Query().Get("LoaiXe"))
+	}
+	if err := resultTemplate.Execute(w, data); err != nil {
+		log.Printf("error rendering result page: %v", err)
+	}
+}
+
+// RenderCaptcha draws text in a small bitmap font with a few noise lines and
+// scales it up so OCR engines can read it, as the fake captcha endpoint
+// serves it.
+func RenderCaptcha(text string) image.Image {
+	face := basicfont.Face7x13
+	width := face.Advance*len(text) + 8
+	height := face.Height + 4
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	noise := color.Gray{Y: 190}
+	for i := 0; i < 3; i++ {
+		y0 := randomInt(height)
+		y1 := randomInt(height)
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y0+(y1-y0)*x/width, noise)
+		}
+	}
+
+	drawer := font.Drawer{
+		Dst:  img,
+		Src:  image.Black,
+		Face: face,
+		Dot:  fixed.P(4, face.Ascent+2),
+	}
+	drawer.DrawString(text)
+
+	return imaging.Resize(img, width*4, height*4, imaging.NearestNeighbor)
+}
+
+func randomInt(n int) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0
+	}
+	return int(v.Int64())
+}
+
+func randomString(n int, charset string) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		sb.WriteByte(charset[randomInt(len(charset))])
+	}
+	return sb.String()
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/plate"
+)
+
+const (
+	defaultJobWorkers   = 4
+	defaultJobQueueSize = 1000
+	defaultJobTTL       = time.Hour
+
+	callbackRetries = 3
+	callbackTimeout = 15 * time.Second
+)
+
+type jobStatus string
+
+const (
+	jobQueued    jobStatus = "queued"
+	jobRunning   jobStatus = "running"
+	jobSucceeded jobStatus = "succeeded"
+	jobFailed    jobStatus = "failed"
+)
+
+var (
+	errJobQueueFull      = errors.New("job queue is full")
+	errJobManagerStopped = errors.New("job manager is shutting down")
+)
+
+// jobManager runs POST /jobs lookups; it is built in main.
+var jobManager *JobManager
+
+// jobRequest is the body of POST /jobs.
+type jobRequest struct {
+	lookupRequest
+	CallbackURL string `json:"callback_url"`
+}
+
+// Job is an asynchronous lookup and its progress.
+type Job struct {
+	ID             string          `json:"id"`
+	Status         jobStatus       `json:"status"`
+	LicensePlate   string          `json:"license_plate"`
+	Plate          plate.Plate     `json:"plate"`
+	VehicleType    string          `json:"vehicle_type"`
+	Attempts       int             `json:"attempts"`
+	Result         *lookupResponse `json:"result,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	CallbackURL    string          `json:"callback_url,omitempty"`
+	CallbackStatus string          `json:"callback_status,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	StartedAt      *time.Time      `json:"started_at,omitempty"`
+	FinishedAt     *time.Time      `json:"finished_at,omitempty"`
+	ExpiresAt      *time.Time      `json:"expires_at,omitempty"`
+
+	forceRefresh bool
+	filter       violationFilter
+	apiKey       *APIKey
+}
+
+// JobManager runs lookup jobs on a fixed pool of workers and keeps finished
+// jobs until they expire.
+type JobManager struct {
+	queue            chan *Job
+	ttl              time.Duration
+	callbackNetworks []netip.Prefix
+	callbackClient   *http.Client
+
+	// ctx is cancelled when Shutdown gives up waiting for running jobs.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+	done    chan struct{}
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	stopped bool
+}
+
+// NewJobManager starts workers that process up to queueSize pending jobs.
+// Finished jobs are kept for ttl. Callbacks only reach public addresses and
+// those in callbackNetworks.
+func NewJobManager(workers, queueSize int, ttl time.Duration, callbackNetworks []netip.Prefix) *JobManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &JobManager{
+		queue:            make(chan *Job, queueSize),
+		ttl:              ttl,
+		callbackNetworks: callbackNetworks,
+		callbackClient:   newCallbackClient(callbackNetworks),
+		ctx:              ctx,
+		cancel:           cancel,
+		done:             make(chan struct{}),
+		jobs:             make(map[string]*Job),
+	}
+
+	m.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+
+	// Drop expired jobs every minute
+	go m.cleanup()
+
+	return m
+}
+
+// Submit queues a lookup job for an already validated plate and returns a
+// snapshot of it. The lookup's upstream costs are charged to key, which is
+// nil when authentication is off.
+func (m *JobManager) Submit(req jobRequest, p plate.Plate, filter violationFilter, key *APIKey) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	job := &Job{
+		ID:           id,
+		Status:       jobQueued,
+		LicensePlate: req.LicensePlate,
+		Plate:        p,
+		VehicleType:  req.VehicleType,
+		CallbackURL:  req.CallbackURL,
+		CreatedAt:    time.Now(),
+		forceRefresh: req.ForceRefresh,
+		filter:       filter,
+		apiKey:       key,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		return Job{}, errJobManagerStopped
+	}
+	select {
+	case m.queue <- job:
+	default:
+		return Job{}, errJobQueueFull
+	}
+	m.jobs[id] = job
+	return *job, nil
+}
+
+// Get returns a snapshot of the job with the given id.
+func (m *JobManager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+func (m *JobManager) worker() {
+	defer m.workers.Done()
+	for job := range m.queue {
+		m.run(job)
+	}
+}
+
+// Shutdown stops accepting jobs and waits for queued and running ones to
+// finish. When ctx is done first, the remaining lookups are cancelled and
+// Shutdown returns ctx.Err() once the workers have exited.
+func (m *JobManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.stopped {
+		m.stopped = true
+		close(m.queue)
+		close(m.done)
+	}
+	m.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		m.cancel()
+		return nil
+	case <-ctx.Done():
+		m.cancel()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+func (m *JobManager) run(job *Job) {
+	now := time.Now()
+	m.mu.Lock()
+	job.Status = jobRunning
+	job.StartedAt = &now
+	m.mu.Unlock()
+
+	ctx := csgt.WithAttemptCallback(m.ctx, func(attempt int) {
+		m.mu.Lock()
+		job.Attempts = attempt
+		m.mu.Unlock()
+	})
+	if job.apiKey != nil {
+		ctx = withAPIKey(ctx, job.apiKey)
+	}
+	if lookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lookupTimeout)
+		defer cancel()
+	}
+
+	outcome, err := lookupLicensePlate(ctx, job.Plate, job.VehicleType, job.forceRefresh)
+
+	finished := time.Now()
+	expires := finished.Add(m.ttl)
+	m.mu.Lock()
+	job.FinishedAt = &finished
+	job.ExpiresAt = &expires
+	if outcome != nil {
+		job.Attempts = outcome.Attempts
+	}
+	if err != nil {
+		job.Status = jobFailed
+		job.Error = err.Error()
+	} else {
+		response := newLookupResponse(job.Plate, outcome, job.filter)
+		job.Status = jobSucceeded
+		job.Result = &response
+	}
+	snapshot := *job
+	m.mu.Unlock()
+
+	if snapshot.CallbackURL != "" {
+		status := "delivered"
+		if err := m.deliverCallback(snapshot); err != nil {
+			log.Printf("job %s: callback to %s failed: %v", snapshot.ID, snapshot.CallbackURL, err)
+			status = "failed"
+		}
+		m.mu.Lock()
+		job.CallbackStatus = status
+		m.mu.Unlock()
+	}
+}
+
+// deliverCallback POSTs the finished job to its callback URL, retrying with
+// exponential backoff on network errors and non-2xx responses.
+func (m *JobManager) deliverCallback(job Job) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("error encoding callback: %w", err)
+	}
+
+	var lastErr error
+	for retry := 0; retry < callbackRetries; retry++ {
+		if retry > 0 {
+			// Exponential backoff: 1s, 2s
+			timer := time.NewTimer(time.Duration(1<<uint(retry-1)) * time.Second)
+			select {
+			case <-m.ctx.Done():
+				timer.Stop()
+				return m.ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		req, err := http.NewRequestWithContext(m.ctx, "POST", job.CallbackURL, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("error creating callback request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := m.callbackClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return fmt.Errorf("failed after %d retries: %w", callbackRetries, lastErr)
+}
+
+// cleanup removes expired jobs periodically
+func (m *JobManager) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case now = <-ticker.C:
+		case <-m.done:
+			return
+		}
+
+		m.mu.Lock()
+		for id, job := range m.jobs {
+			if job.ExpiresAt != nil && now.After(*job.ExpiresAt) {
+				delete(m.jobs, id)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+func createJobHandler(w http.ResponseWriter, r *http.Request) {
+	// Apply per-key or per-IP rate limiting
+	ctx, ok := limitRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var requestData jobRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	licensePlate, err := requestData.parsedPlate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := requestData.violationFilter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if requestData.CallbackURL != "" {
+		if err := checkCallbackURL(requestData.CallbackURL, jobManager.callbackNetworks); err != nil {
+			http.Error(w, "Invalid callback_url: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := consumeQuota(ctx); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+
+	job, err := jobManager.Submit(requestData, licensePlate, filter, apiKeyFrom(ctx))
+	if errors.Is(err, errJobQueueFull) || errors.Is(err, errJobManagerStopped) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		log.Printf("error encoding job: %v", err)
+	}
+}
+
+func getJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := jobManager.Get(r.PathValue("id"))
+	// Jobs submitted with an API key are only visible to that key.
+	if ok && job.apiKey != nil && job.apiKey != apiKeyFrom(r.Context()) {
+		ok = false
+	}
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
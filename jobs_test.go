@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"LicensePlatecheck/internal/fakecsgt"
+	"LicensePlatecheck/plate"
+)
+
+func submitJob(t *testing.T, m *JobManager, licensePlate, callbackURL string) Job {
+	t.Helper()
+	p, err := plate.Parse(licensePlate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := jobRequest{lookupRequest: lookupRequest{LicensePlate: licensePlate, VehicleType: "1"}, CallbackURL: callbackURL}
+	job, err := m.Submit(req, p, violationFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != jobQueued || job.StartedAt != nil || job.FinishedAt != nil {
+		t.Errorf("submitted job = %+v, want a queued job", job)
+	}
+	return job
+}
+
+// waitForJob polls m until the job has finished and its callback, if any,
+// has been delivered or given up on.
+func waitForJob(t *testing.T, m *JobManager, id string) Job {
+	t.Helper()
+	var job Job
+	waitFor(t, func() bool {
+		var ok bool
+		job, ok = m.Get(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		return job.FinishedAt != nil && (job.CallbackURL == "" || job.CallbackStatus != "")
+	})
+	return job
+}
+
+func TestJobLifecycle(t *testing.T) {
+	useFakeUpstream(t, fakecsgt.Config{PlateScenarios: map[string]fakecsgt.Scenario{
+		"98B378578": fakecsgt.ScenarioViolations,
+		"51F12345":  fakecsgt.ScenarioMalformedJSON,
+	}})
+
+	callbacks := make(chan Job, 2)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var job Job
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			t.Errorf("callback body: %v", err)
+		}
+		callbacks <- job
+	}))
+	defer receiver.Close()
+
+	m := NewJobManager(2, 10, time.Minute, []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")})
+	defer m.Shutdown(context.Background())
+
+	t.Run("succeeded", func(t *testing.T) {
+		submitted := submitJob(t, m, "98B378578", receiver.URL+"/done")
+		job := waitForJob(t, m, submitted.ID)
+		if job.Status != jobSucceeded || job.Error != "" || job.Result == nil || job.Result.ViolationCount == 0 {
+			t.Fatalf("job = %+v, want succeeded with violations", job)
+		}
+		if job.Attempts != 1 {
+			t.Errorf("attempts = %d, want 1", job.Attempts)
+		}
+		if job.StartedAt == nil || job.ExpiresAt == nil || job.FinishedAt.Before(*job.StartedAt) ||
+			!job.ExpiresAt.Equal(job.FinishedAt.Add(time.Minute)) {
+			t.Errorf("started %v, finished %v, expires %v", job.StartedAt, job.FinishedAt, job.ExpiresAt)
+		}
+		if job.CallbackStatus != "delivered" {
+			t.Errorf("callback status = %q, want delivered", job.CallbackStatus)
+		}
+		got := <-callbacks
+		if got.ID != job.ID || got.Status != jobSucceeded || got.Result == nil {
+			t.Errorf("callback got %+v, want the finished job", got)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		submitted := submitJob(t, m, "51F12345", "")
+		job := waitForJob(t, m, submitted.ID)
+		if job.Status != jobFailed || job.Error == "" || job.Result != nil {
+			t.Errorf("job = %+v, want failed with an error", job)
+		}
+		if job.CallbackStatus != "" {
+			t.Errorf("callback status = %q without a callback", job.CallbackStatus)
+		}
+	})
+
+	if _, ok := m.Get("unknown"); ok {
+		t.Error("Get found an unknown job")
+	}
+}
+
+func TestJobManagerRefusesJobs(t *testing.T) {
+	p, err := plate.Parse("30A12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := jobRequest{lookupRequest: lookupRequest{LicensePlate: "30A12345", VehicleType: "1"}}
+
+	// Without workers nothing leaves the queue.
+	m := NewJobManager(0, 1, time.Minute, nil)
+	if _, err := m.Submit(req, p, violationFilter{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Submit(req, p, violationFilter{}, nil); !errors.Is(err, errJobQueueFull) {
+		t.Errorf("Submit to a full queue = %v, want %v", err, errJobQueueFull)
+	}
+
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Submit(req, p, violationFilter{}, nil); !errors.Is(err, errJobManagerStopped) {
+		t.Errorf("Submit after Shutdown = %v, want %v", err, errJobManagerStopped)
+	}
+}
+
+func TestJobManagerShutdownCancelsRunningJobs(t *testing.T) {
+	useFakeUpstream(t, fakecsgt.Config{Scenario: fakecsgt.ScenarioSlow, Delay: time.Minute})
+	m := NewJobManager(1, 10, time.Minute, nil)
+	submitted := submitJob(t, m, "30A12345", "")
+	waitFor(t, func() bool {
+		job, _ := m.Get(submitted.ID)
+		return job.Status == jobRunning
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+	job, _ := m.Get(submitted.ID)
+	if job.Status != jobFailed || job.FinishedAt == nil {
+		t.Errorf("job = %+v, want failed once cancelled", job)
+	}
+}
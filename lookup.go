@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/plate"
+)
+
+var (
+	// lookupClient performs the upstream lookups; it is built in main.
+	lookupClient *csgt.Client
+
+	// resultCache sits in front of checkLicensePlate; it is built in main.
+	resultCache *LookupCache
+)
+
+// checkLicensePlate looks licensePlate up on csgt.vn. It runs behind
+// resultCache, which takes the global rate limit token first.
+func checkLicensePlate(ctx context.Context, licensePlate, vehicleType string) (*csgt.SubmitFormResponse, int, error) {
+	result, attempts, err := lookupClient.Lookup(ctx, licensePlate, vehicleType)
+	if err == nil {
+		notifyLookupChanges(ctx, licensePlate, vehicleType, result)
+		recordLookup(licensePlate, vehicleType, result, attempts)
+	}
+	return result, attempts, err
+}
+
+// lookupLicensePlate answers from the result cache when possible and falls
+// back to checkLicensePlate otherwise. The plate is sent upstream in its
+// compact form.
+func lookupLicensePlate(ctx context.Context, p plate.Plate, vehicleType string, forceRefresh bool) (*lookupOutcome, error) {
+	return resultCache.Lookup(ctx, p.Compact(), vehicleType, forceRefresh, checkLicensePlate)
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"LicensePlatecheck/csgt"
+
 	"github.com/joho/godotenv"
 )
 
@@ -15,19 +24,256 @@ func main() {
 		log.Println("Warning: .env file not found, using default/empty values")
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "bench-captcha" {
+		if err := runBenchCaptcha(os.Args[2:]); err != nil {
+			log.Fatalf("bench-captcha: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "train-captcha" {
+		if err := runTrainCaptcha(os.Args[2:]); err != nil {
+			log.Fatalf("train-captcha: %v", err)
+		}
+		return
+	}
+
 	// Load API key from environment
-	apiKey = os.Getenv("OCR_API_KEY")
+	apiKey := os.Getenv("OCR_API_KEY")
 	if apiKey == "" {
 		log.Println("Warning: OCR_API_KEY not set in .env, OCR.space API will not work")
 	}
 
-	http.HandleFunc("/check-license-plate", licensePlateHandler)
+	solver, err := loadCaptchaSolver(apiKey)
+	if err != nil {
+		log.Fatalf("Invalid captcha solver configuration: %v", err)
+	}
+	log.Printf("Captcha solver chain: %s", solver.Name())
+
+	pipelines, vote, err := loadPreprocessing()
+	if err != nil {
+		log.Fatalf("Invalid captcha preprocessing configuration: %v", err)
+	}
+	if len(pipelines) > 1 {
+		names := make([]string, len(pipelines))
+		for i, p := range pipelines {
+			names[i] = p.Name
+		}
+		log.Printf("Captcha preprocessing variants: %s (%s vote)", strings.Join(names, ", "), vote)
+	}
+
+	captchaCheck, err := loadCaptchaCheck()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	maxAttempts, err := envInt("CAPTCHA_MAX_ATTEMPTS", csgt.DefaultMaxAttempts)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	setLookupAttemptsMax(maxAttempts)
+
+	clientOpts := []csgt.Option{
+		csgt.WithSolver(solver),
+		csgt.WithMaxAttempts(maxAttempts),
+		csgt.WithPreprocessing(pipelines, vote),
+		csgt.WithCaptchaCheck(captchaCheck),
+		csgt.WithObserver(csgt.Observers(metricsObserver{}, usageObserver{})),
+	}
+	if baseURL := os.Getenv("CSGT_BASE_URL"); baseURL != "" {
+		if err := validateHTTPURL(baseURL); err != nil {
+			log.Fatalf("Invalid CSGT_BASE_URL: %v", err)
+		}
+		log.Printf("Using CSGT upstream at %s", baseURL)
+		clientOpts = append(clientOpts, csgt.WithBaseURL(baseURL))
+	}
+	if dir := os.Getenv("CAPTCHA_DATASET_DIR"); dir != "" {
+		dataset, err := csgt.NewDataset(dir)
+		if err != nil {
+			log.Fatalf("Invalid CAPTCHA_DATASET_DIR: %v", err)
+		}
+		log.Printf("Saving submitted captchas to %s", dir)
+		clientOpts = append(clientOpts, csgt.WithCaptchaRecorder(dataset))
+	}
+	lookupClient = csgt.NewClient(clientOpts...)
+
+	lookupTimeout, err = envDuration("LOOKUP_TIMEOUT", 0)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	if mode := os.Getenv("RATE_LIMIT_MODE"); mode != "" {
+		if mode != rateLimitModeWait && mode != rateLimitModeReject {
+			log.Fatalf("Invalid configuration: invalid RATE_LIMIT_MODE %q: want %q or %q", mode, rateLimitModeWait, rateLimitModeReject)
+		}
+		rateLimitMode = mode
+	}
+	rateLimitWaitBudget, err = envDuration("RATE_LIMIT_WAIT_BUDGET", defaultRateLimitWaitBudget)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if rateLimitMode == rateLimitModeReject {
+		log.Printf("Rate limit mode: reject with 429 after waiting %s", rateLimitWaitBudget)
+	}
+
+	ipIdleTTL, err := envDuration("RATE_LIMIT_IP_IDLE_TTL", defaultIPLimiterIdleTTL)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	ipMaxKeys, err := envInt("RATE_LIMIT_IP_MAX_KEYS", defaultIPLimiterMaxKeys)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	trustedProxies, err = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if len(trustedProxies) > 0 {
+		log.Printf("Trusting forwarding headers from: %v", trustedProxies)
+	}
+	ipRateLimiter = NewIPRateLimiter(10, 100*time.Millisecond, ipIdleTTL, ipMaxKeys)
+
+	cacheTTL, err := envDuration("CACHE_TTL", defaultCacheTTL)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	negativeCacheTTL, err := envDuration("CACHE_NEGATIVE_TTL", defaultNegativeCacheTTL)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	resultCache = NewLookupCache(cacheTTL, negativeCacheTTL, globalRateLimiter)
+	log.Printf("Result cache TTL: %s (no violations: %s)", cacheTTL, negativeCacheTTL)
+
+	batchWorkers, err = envInt("BATCH_WORKERS", defaultBatchWorkers)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	batchMaxItems, err = envInt("BATCH_MAX_ITEMS", defaultBatchMaxItems)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	jobWorkers, err := envInt("JOB_WORKERS", defaultJobWorkers)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	jobQueueSize, err := envInt("JOB_QUEUE_SIZE", defaultJobQueueSize)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	jobTTL, err := envDuration("JOB_TTL", defaultJobTTL)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	callbackNetworks, err := loadCallbackAllowedNetworks()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	jobManager = NewJobManager(jobWorkers, jobQueueSize, jobTTL, callbackNetworks)
+
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		apiKeys, err = LoadAPIKeys(path)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		log.Printf("API key authentication enabled for %d keys", len(apiKeys.Keys()))
+	}
+	usageFile := os.Getenv("USAGE_FILE")
+	if usageFile == "" {
+		usageFile = defaultUsageFile
+	}
+	if apiKeys != nil {
+		usageStore, err = NewUsageStore(usageFile)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+	}
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = defaultDBPath
+	}
+	db, err := openDatabase(dbPath)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	defer db.Close()
+	historyStore, err = NewHistoryStore(db)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	log.Printf("Lookup history stored in %s", dbPath)
+
+	watchInterval, err := envDuration("WATCH_INTERVAL", defaultWatchInterval)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	watchJitter, err := envDuration("WATCH_JITTER", defaultWatchJitter)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	watchWorkers, err := envInt("WATCH_WORKERS", defaultWatchWorkers)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	notifiers, err := loadNotifiers()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if len(notifiers) > 0 {
+		notifications = NewNotifications(notifiers...)
+		names := make([]string, len(notifiers))
+		for i, notifier := range notifiers {
+			names[i] = notifier.Name()
+		}
+		log.Printf("Notifying violation changes via: %s", strings.Join(names, ", "))
+	}
+
+	watcher, err = NewWatcher(db, watchInterval, watchJitter, watchWorkers)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	watcher.Start()
+	log.Printf("Watchlist rechecks every %s ± %s", watchInterval, watchJitter)
+
+	http.HandleFunc("/check-license-plate", requireAPIKey("/check-license-plate", licensePlateHandler))
+	http.HandleFunc("/check-license-plates/batch", requireAPIKey("/check-license-plates/batch", batchHandler))
+	http.HandleFunc("POST /jobs", requireAPIKey("/jobs", createJobHandler))
+	http.HandleFunc("GET /jobs/{id}", requireAPIKey("/jobs", getJobHandler))
+	http.HandleFunc("GET /plates/{plate}/history", requireAPIKey("/plates", plateHistoryHandler))
+	http.HandleFunc("POST /watchlist", requireAPIKey("/watchlist", createWatchHandler))
+	http.HandleFunc("GET /watchlist", requireAPIKey("/watchlist", listWatchHandler))
+	http.HandleFunc("GET /watchlist/{id}", requireAPIKey("/watchlist", getWatchHandler))
+	http.HandleFunc("PUT /watchlist/{id}", requireAPIKey("/watchlist", updateWatchHandler))
+	http.HandleFunc("DELETE /watchlist/{id}", requireAPIKey("/watchlist", deleteWatchHandler))
+	if apiKeys != nil {
+		http.HandleFunc("GET /usage", requireAPIKey("/usage", usageHandler))
+	}
+	// With METRICS_ADDR set, /metrics is served only there, without API keys;
+	// otherwise it sits behind them on the main port, which leaves it open to
+	// anyone when API keys are off.
+	metricsAddr := os.Getenv("METRICS_ADDR")
+	if metricsAddr == "" {
+		http.HandleFunc("GET /metrics", requireAPIKey("/metrics", metricsRegistry.Handler().ServeHTTP))
+		if apiKeys == nil {
+			log.Printf("warning: /metrics is public on the main port; set API_KEYS_FILE or METRICS_ADDR to restrict it")
+		}
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	shutdownTimeout, err := envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// baseCtx is the parent of every request context; cancelling it aborts
+	// lookups still running when the drain timeout expires.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	// Optimize HTTP server settings for high load
 	server := &http.Server{
 		Addr:           ":" + port,
@@ -35,12 +281,97 @@ func main() {
 		WriteTimeout:   60 * time.Second,
 		IdleTimeout:    120 * time.Second,
 		MaxHeaderBytes: 1 << 20, // 1 MB
+		BaseContext:    func(net.Listener) context.Context { return baseCtx },
 	}
 
-	log.Printf("Server starting on port %s with optimized settings...", port)
-	log.Printf("Global rate limit: 200 requests/second")
-	log.Printf("Per-IP rate limit: 10 requests/second")
-	if err := server.ListenAndServe(); err != nil {
+	if metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metricsRegistry.Handler())
+		metricsServer := &http.Server{
+			Addr:         metricsAddr,
+			Handler:      mux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		defer metricsServer.Close()
+		go func() {
+			log.Printf("Serving metrics on %s", metricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Metrics server failed to start: %v", err)
+			}
+		}()
+	}
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on port %s with optimized settings...", port)
+		log.Printf("Global rate limit: 200 requests/second")
+		log.Printf("Per-IP rate limit: 10 requests/second")
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Fatalf("Server failed to start: %v", err)
+	case <-signalCtx.Done():
+		stop()
+	}
+
+	log.Printf("Shutting down, draining in-flight lookups for up to %s...", shutdownTimeout)
+	shutdown(server, cancelRequests, shutdownTimeout)
+	log.Println("Server stopped")
+}
+
+// shutdown stops accepting requests, jobs and watchlist checks, waits up to
+// timeout for running lookups, then cancels whatever is left and stops the
+// rate limiters.
+func shutdown(server *http.Server, cancelRequests context.CancelFunc, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Drain timeout reached, cancelling remaining requests: %v", err)
+			cancelRequests()
+
+			// Give cancelled handlers a moment to write their error responses.
+			graceCtx, cancelGrace := context.WithTimeout(context.Background(), shutdownGrace)
+			defer cancelGrace()
+			if err := server.Shutdown(graceCtx); err != nil {
+				server.Close()
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := jobManager.Shutdown(ctx); err != nil {
+			log.Printf("Drain timeout reached, cancelled remaining jobs: %v", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := watcher.Shutdown(ctx); err != nil {
+			log.Printf("Drain timeout reached, cancelled remaining watchlist checks: %v", err)
+		}
+	}()
+	wg.Wait()
+
+	// Lookups and watchlist checks are done; deliver what they found.
+	if err := notifications.Shutdown(ctx); err != nil {
+		log.Printf("Drain timeout reached, dropped pending notifications: %v", err)
+	}
+
+	if usageStore != nil {
+		if err := usageStore.Close(); err != nil {
+			log.Printf("Error saving API key usage: %v", err)
+		}
 	}
+	globalRateLimiter.Close()
+	ipRateLimiter.Close()
 }
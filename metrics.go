@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/metrics"
+)
+
+// metricsRegistry backs the /metrics endpoint.
+var metricsRegistry = metrics.NewRegistry()
+
+var (
+	solverAttempts = metricsRegistry.NewCounterVec("csgt_captcha_solve_attempts_total",
+		"Captcha solver runs, by solver.", "solver")
+	solverSuccesses = metricsRegistry.NewCounterVec("csgt_captcha_solve_successes_total",
+		"Captcha solver runs that produced text, by solver.", "solver")
+	solverDuration = metricsRegistry.NewHistogramVec("csgt_captcha_solve_duration_seconds",
+		"Time spent in each captcha solver.", metrics.DefBuckets, "solver")
+
+	captchaSubmissions = metricsRegistry.NewCounterVec("csgt_captcha_submissions_total",
+		"Captchas submitted upstream, by whether CSGT accepted them (result=accepted|mismatch).", "result")
+	captchaSkips = metricsRegistry.NewCounterVec("csgt_captcha_skipped_total",
+		"Captcha reads replaced by a fresh captcha instead of being submitted (reason=low_confidence|malformed).", "reason")
+
+	lookupsTotal = metricsRegistry.NewCounterVec("csgt_lookups_total",
+		"Upstream lookups, by outcome (violations|no_violations|error).", "outcome")
+
+	upstreamDuration = metricsRegistry.NewHistogramVec("csgt_upstream_request_duration_seconds",
+		"Latency of requests to CSGT, by step (captcha|submit|result).", metrics.DefBuckets, "step")
+	upstreamErrors = metricsRegistry.NewCounterVec("csgt_upstream_request_errors_total",
+		"Requests to CSGT that failed before a full response was read, by step.", "step")
+	resultRetries = metricsRegistry.NewCounterVec("csgt_result_page_retries_total",
+		"Repeated fetches of the result page after a failed attempt.")
+
+	rateLimitWait = metricsRegistry.NewHistogramVec("ratelimit_wait_seconds",
+		"Time spent waiting for a rate limiter token, by limiter (global|ip).",
+		[]float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30}, "limiter")
+	rateLimitRejections = metricsRegistry.NewCounterVec("ratelimit_rejections_total",
+		"Requests rejected because no token was free within the wait budget, by limiter.", "limiter")
+)
+
+// lookupAttempts has a bucket for every attempt count up to the default
+// maximum until setLookupAttemptsMax adapts it to the configured one.
+var lookupAttempts = metricsRegistry.NewHistogramVec("csgt_lookup_attempts",
+	"Captcha/submit attempts used per upstream lookup.", metrics.LinearBuckets(1, 1, csgt.DefaultMaxAttempts))
+
+// setLookupAttemptsMax gives csgt_lookup_attempts a bucket for every attempt
+// count up to maxAttempts.
+func setLookupAttemptsMax(maxAttempts int) {
+	lookupAttempts.SetBuckets(metrics.LinearBuckets(1, 1, maxAttempts))
+}
+
+// metricsObserver records csgt.Client events into the metrics registry.
+type metricsObserver struct{}
+
+func (metricsObserver) UpstreamRequest(_ context.Context, step csgt.Step, d time.Duration, err error) {
+	upstreamDuration.WithLabelValues(string(step)).Observe(d.Seconds())
+	if err != nil {
+		upstreamErrors.WithLabelValues(string(step)).Inc()
+	}
+}
+
+func (metricsObserver) SolverAttempt(_ context.Context, solver string, d time.Duration, err error) {
+	solverAttempts.WithLabelValues(solver).Inc()
+	solverDuration.WithLabelValues(solver).Observe(d.Seconds())
+	if err == nil {
+		solverSuccesses.WithLabelValues(solver).Inc()
+	}
+}
+
+func (metricsObserver) CaptchaSubmitted(_ context.Context, accepted bool) {
+	if accepted {
+		captchaSubmissions.WithLabelValues("accepted").Inc()
+	} else {
+		captchaSubmissions.WithLabelValues("mismatch").Inc()
+	}
+}
+
+func (metricsObserver) CaptchaSkipped(_ context.Context, reason string) {
+	captchaSkips.WithLabelValues(reason).Inc()
+}
+
+func (metricsObserver) ResultRetry(context.Context) {
+	resultRetries.WithLabelValues().Inc()
+}
+
+func (metricsObserver) LookupFinished(_ context.Context, result *csgt.SubmitFormResponse, attempts int, err error) {
+	// A lookup abandoned before its first attempt says nothing about CSGT.
+	if attempts == 0 && errors.Is(err, context.Canceled) {
+		return
+	}
+	lookupAttempts.WithLabelValues().Observe(float64(attempts))
+
+	switch {
+	case err != nil:
+		lookupsTotal.WithLabelValues("error").Inc()
+	case getViolationCount(result.Details) > 0:
+		lookupsTotal.WithLabelValues("violations").Inc()
+	default:
+		lookupsTotal.WithLabelValues("no_violations").Inc()
+	}
+}
@@ -0,0 +1,353 @@
+// Package metrics implements the small subset of Prometheus client features
+// this service needs: labelled counters and histograms exposed in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are latency buckets in seconds suited to upstream HTTP calls.
+var DefBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 45}
+
+// LinearBuckets returns count buckets, the lowest at start and each width
+// above the one before.
+func LinearBuckets(start, width float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start + float64(i)*width
+	}
+	return buckets
+}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics and renders them for scraping.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo renders every registered metric in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the registry at a /metrics endpoint.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// vec keeps one child per combination of label values.
+type vec[T any] struct {
+	name     string
+	help     string
+	typ      string
+	labels   []string
+	newChild func() T
+
+	mu       sync.RWMutex
+	children map[string]T
+	values   map[string][]string
+}
+
+func (v *vec[T]) with(values []string) T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok := v.children[key]; ok {
+		return child
+	}
+	child = v.newChild()
+	v.children[key] = child
+	v.values[key] = append([]string(nil), values...)
+	return child
+}
+
+// sorted returns children ordered by label values for stable output.
+func (v *vec[T]) sorted() ([]T, [][]string) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	children := make([]T, len(keys))
+	values := make([][]string, len(keys))
+	for i, key := range keys {
+		children[i] = v.children[key]
+		values[i] = v.values[key]
+	}
+	return children, values
+}
+
+func (v *vec[T]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds delta, which must not be negative.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.value += delta
+	c.mu.Unlock()
+}
+
+func (c *Counter) get() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// CounterVec is a family of counters partitioned by labels.
+type CounterVec struct {
+	vec[*Counter]
+}
+
+// NewCounterVec registers a counter family with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	cv := &CounterVec{vec[*Counter]{
+		name:     name,
+		help:     help,
+		typ:      "counter",
+		labels:   labels,
+		newChild: func() *Counter { return &Counter{} },
+		children: make(map[string]*Counter),
+		values:   make(map[string][]string),
+	}}
+	if len(labels) == 0 {
+		cv.with(nil) // expose unlabelled counters from the start
+	}
+	r.register(name, cv)
+	return cv
+}
+
+// WithLabelValues returns the counter for the given label values.
+func (cv *CounterVec) WithLabelValues(values ...string) *Counter {
+	return cv.with(values)
+}
+
+func (cv *CounterVec) write(w *bufio.Writer) {
+	cv.writeHeader(w)
+	children, values := cv.sorted()
+	for i, c := range children {
+		fmt.Fprintf(w, "%s%s %s\n", cv.name, formatLabels(cv.labels, values[i], "", ""), formatFloat(c.get()))
+	}
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	upper   []float64
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.upper {
+		if v <= upper {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// HistogramVec is a family of histograms partitioned by labels.
+type HistogramVec struct {
+	vec[*Histogram]
+	buckets []float64
+}
+
+// NewHistogramVec registers a histogram family with the given upper bucket
+// bounds and label names.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	hv := &HistogramVec{buckets: sortedBuckets(buckets)}
+	hv.vec = vec[*Histogram]{
+		name:   name,
+		help:   help,
+		typ:    "histogram",
+		labels: labels,
+		// Called with hv.mu held, like SetBuckets.
+		newChild: func() *Histogram {
+			return &Histogram{upper: hv.buckets, buckets: make([]uint64, len(hv.buckets))}
+		},
+		children: make(map[string]*Histogram),
+		values:   make(map[string][]string),
+	}
+	if len(labels) == 0 {
+		hv.with(nil)
+	}
+	r.register(name, hv)
+	return hv
+}
+
+// SetBuckets replaces the upper bucket bounds, for when they depend on
+// configuration read after the histogram was registered. Observations made so
+// far are dropped.
+func (hv *HistogramVec) SetBuckets(buckets []float64) {
+	hv.mu.Lock()
+	hv.buckets = sortedBuckets(buckets)
+	clear(hv.children)
+	clear(hv.values)
+	if len(hv.labels) == 0 {
+		hv.children[""] = hv.newChild()
+		hv.values[""] = nil
+	}
+	hv.mu.Unlock()
+}
+
+func sortedBuckets(buckets []float64) []float64 {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return buckets
+}
+
+// WithLabelValues returns the histogram for the given label values.
+func (hv *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return hv.with(values)
+}
+
+func (hv *HistogramVec) write(w *bufio.Writer) {
+	hv.writeHeader(w)
+	children, values := hv.sorted()
+	for i, h := range children {
+		h.mu.Lock()
+		for j, upper := range h.upper {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", hv.name, formatLabels(hv.labels, values[i], "le", formatFloat(upper)), h.buckets[j])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", hv.name, formatLabels(hv.labels, values[i], "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", hv.name, formatLabels(hv.labels, values[i], "", ""), formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", hv.name, formatLabels(hv.labels, values[i], "", ""), h.count)
+		h.mu.Unlock()
+	}
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, "%s=\"%s\"", name, escapeLabel(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, "%s=\"%s\"", extraName, extraValue)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, r *Registry) string {
+	t.Helper()
+	var sb strings.Builder
+	n, err := r.WriteTo(&sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(sb.Len()) {
+		t.Errorf("WriteTo reported %d bytes, wrote %d", n, sb.Len())
+	}
+	return sb.String()
+}
+
+func TestCounterExposition(t *testing.T) {
+	r := NewRegistry()
+	cv := r.NewCounterVec("lookups_total", "Lookups, by outcome.\nSecond line \\ here.", "outcome")
+	cv.WithLabelValues("violations").Inc()
+	cv.WithLabelValues("error").Add(2.5)
+	cv.WithLabelValues("error").Add(-1) // ignored
+	cv.WithLabelValues(`say "hi"` + "\n\\").Inc()
+	r.NewCounterVec("retries_total", "Retries.")
+
+	want := `# HELP lookups_total Lookups, by outcome.\nSecond line \\ here.
+# TYPE lookups_total counter
+lookups_total{outcome="error"} 2.5
+lookups_total{outcome="say \"hi\"\n\\"} 1
+lookups_total{outcome="violations"} 1
+# HELP retries_total Retries.
+# TYPE retries_total counter
+retries_total 0
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramExposition(t *testing.T) {
+	r := NewRegistry()
+	hv := r.NewHistogramVec("solve_seconds", "Solve time.", []float64{1, 0.5}, "solver")
+	hv.WithLabelValues("tesseract").Observe(0.5)
+	hv.WithLabelValues("tesseract").Observe(0.75)
+	hv.WithLabelValues("tesseract").Observe(3)
+
+	want := `# HELP solve_seconds Solve time.
+# TYPE solve_seconds histogram
+solve_seconds_bucket{solver="tesseract",le="0.5"} 1
+solve_seconds_bucket{solver="tesseract",le="1"} 2
+solve_seconds_bucket{solver="tesseract",le="+Inf"} 3
+solve_seconds_sum{solver="tesseract"} 4.25
+solve_seconds_count{solver="tesseract"} 3
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramSetBuckets(t *testing.T) {
+	r := NewRegistry()
+	hv := r.NewHistogramVec("attempts", "Attempts.", LinearBuckets(1, 1, 2))
+	hv.WithLabelValues().Observe(2)
+	hv.SetBuckets(LinearBuckets(1, 1, 3))
+	hv.WithLabelValues().Observe(3)
+
+	want := `# HELP attempts Attempts.
+# TYPE attempts histogram
+attempts_bucket{le="1"} 0
+attempts_bucket{le="2"} 0
+attempts_bucket{le="3"} 1
+attempts_bucket{le="+Inf"} 1
+attempts_sum 3
+attempts_count 1
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLinearBuckets(t *testing.T) {
+	got := LinearBuckets(1, 2, 4)
+	want := []float64{1, 3, 5, 7}
+	if len(got) != len(want) {
+		t.Fatalf("LinearBuckets = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("LinearBuckets = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDuplicateMetricPanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("lookups_total", "Lookups.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a metric twice did not panic")
+		}
+	}()
+	r.NewHistogramVec("lookups_total", "Lookups.", DefBuckets)
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("retries_total", "Retries.").WithLabelValues().Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the text exposition format", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "retries_total 1\n") {
+		t.Errorf("body = %q, want retries_total 1", rec.Body.String())
+	}
+}
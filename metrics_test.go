@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"LicensePlatecheck/csgt"
+)
+
+// TestLookupAttemptsBeforeConfiguration observes a lookup before
+// setLookupAttemptsMax has run, as a client built outside main would.
+func TestLookupAttemptsBeforeConfiguration(t *testing.T) {
+	metricsObserver{}.LookupFinished(context.Background(), nil, 2, errors.New("upstream down"))
+
+	var sb strings.Builder
+	if _, err := metricsRegistry.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), fmt.Sprintf(`csgt_lookup_attempts_bucket{le="%d"}`, csgt.DefaultMaxAttempts)) {
+		t.Errorf("csgt_lookup_attempts has no default buckets:\n%s", sb.String())
+	}
+}
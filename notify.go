@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/plate"
+)
+
+const (
+	// notifyQueueSize bounds notifications waiting for delivery; more are
+	// dropped with a log line rather than slowing lookups down.
+	notifyQueueSize = 100
+
+	notifyRetries = 3
+	notifyTimeout = 15 * time.Second
+)
+
+// notifyRetryDelay is the wait before the first retry; it doubles for each
+// one after.
+var notifyRetryDelay = time.Second
+
+// Notification sources.
+const (
+	notifySourceLookup    = "lookup"
+	notifySourceWatchlist = "watchlist"
+)
+
+// Notification tells the configured channels that the violations of a plate
+// changed since it was last checked.
+type Notification struct {
+	Source      string        `json:"source"`
+	WatchID     string        `json:"watch_id,omitempty"`
+	Label       string        `json:"label,omitempty"`
+	Plate       plate.Plate   `json:"plate"`
+	VehicleType string        `json:"vehicle_type"`
+	CheckedAt   time.Time     `json:"checked_at"`
+	Changes     violationDiff `json:"changes"`
+}
+
+// Notifier delivers notifications to one channel.
+type Notifier interface {
+	// Name identifies the channel in logs, e.g. "webhook".
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Notifications delivers notifications to every configured channel in the
+// background, so lookups never wait for a slow webhook or mail server.
+type Notifications struct {
+	notifiers []Notifier
+	queue     chan Notification
+
+	// ctx is cancelled when Shutdown gives up waiting for deliveries.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// notifications is built in main and stays nil when no channel is
+// configured; sending to a nil *Notifications does nothing.
+var notifications *Notifications
+
+// NewNotifications starts delivering to notifiers.
+func NewNotifications(notifiers ...Notifier) *Notifications {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifications{
+		notifiers: notifiers,
+		queue:     make(chan Notification, notifyQueueSize),
+		ctx:       ctx,
+		cancel:    cancel,
+		stopped:   make(chan struct{}),
+	}
+	go n.deliver()
+	return n
+}
+
+// Send queues a notification for every channel.
+func (n *Notifications) Send(notification Notification) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	select {
+	case n.queue <- notification:
+	default:
+		log.Printf("notify: queue full, dropping notification for %s", notification.Plate)
+	}
+}
+
+func (n *Notifications) deliver() {
+	defer close(n.stopped)
+
+	for notification := range n.queue {
+		var wg sync.WaitGroup
+		for _, notifier := range n.notifiers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(n.ctx, notifyRetries*notifyTimeout)
+				defer cancel()
+				if err := notifier.Notify(ctx, notification); err != nil {
+					log.Printf("notify: %s: error notifying %s: %v", notifier.Name(), notification.Plate, err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// Shutdown stops accepting notifications and waits for queued ones to be
+// delivered. When ctx is done first the remaining deliveries are cancelled.
+func (n *Notifications) Shutdown(ctx context.Context) error {
+	if n == nil {
+		return nil
+	}
+
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	select {
+	case <-n.stopped:
+		n.cancel()
+		return nil
+	case <-ctx.Done():
+		n.cancel()
+		<-n.stopped
+		return ctx.Err()
+	}
+}
+
+type watchCheckContextKey struct{}
+
+// withWatchCheck marks ctx as a watchlist recheck, whose changes the watcher
+// reports itself.
+func withWatchCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, watchCheckContextKey{}, true)
+}
+
+func isWatchCheck(ctx context.Context) bool {
+	watch, _ := ctx.Value(watchCheckContextKey{}).(bool)
+	return watch
+}
+
+// notifyLookupChanges compares a fresh upstream lookup with the last saved
+// one of the same plate and vehicle type and sends what changed. It must run
+// before the lookup itself is saved. Plates never looked up before have
+// nothing to compare with and send nothing.
+func notifyLookupChanges(ctx context.Context, licensePlate, vehicleType string, result *csgt.SubmitFormResponse) {
+	if notifications == nil || historyStore == nil || isWatchCheck(ctx) {
+		return
+	}
+	if !result.Success.Bool() || (result.Href != "" && result.Details == nil) {
+		return
+	}
+
+	previous, err := historyStore.Latest(licensePlate, vehicleType)
+	if err != nil {
+		log.Printf("notify: error reading history of %s: %v", licensePlate, err)
+		return
+	}
+	if previous == nil {
+		return
+	}
+
+	var before, after []csgt.Violation
+	if previous.Details != nil {
+		before = previous.Details.Violations
+	}
+	if result.Details != nil {
+		after = result.Details.Violations
+	}
+	diff := diffViolations(before, after)
+	if diff.Empty() {
+		return
+	}
+
+	p, err := plate.Parse(licensePlate)
+	if err != nil {
+		return
+	}
+	notifications.Send(Notification{
+		Source:      notifySourceLookup,
+		Plate:       p,
+		VehicleType: vehicleType,
+		CheckedAt:   time.Now(),
+		Changes:     diff,
+	})
+}
+
+// loadNotifiers builds the channels configured in the environment.
+func loadNotifiers() ([]Notifier, error) {
+	var notifiers []Notifier
+
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		if err := validateHTTPURL(url); err != nil {
+			return nil, fmt.Errorf("invalid NOTIFY_WEBHOOK_URL: %w", err)
+		}
+		notifiers = append(notifiers, NewWebhookNotifier(url, os.Getenv("NOTIFY_WEBHOOK_SECRET")))
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port, err := envInt("SMTP_PORT", defaultSMTPPort)
+		if err != nil {
+			return nil, err
+		}
+		cfg := smtpConfig{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+			To:       splitList(os.Getenv("NOTIFY_EMAIL_TO")),
+		}
+		if cfg.From == "" || len(cfg.To) == 0 {
+			return nil, errors.New("SMTP_HOST needs SMTP_FROM and NOTIFY_EMAIL_TO")
+		}
+		notifiers = append(notifiers, NewEmailNotifier(cfg))
+	}
+
+	if token := os.Getenv("TELEGRAM_BOT_TOKEN"); token != "" {
+		chatID := os.Getenv("TELEGRAM_CHAT_ID")
+		if chatID == "" {
+			return nil, errors.New("TELEGRAM_BOT_TOKEN needs TELEGRAM_CHAT_ID")
+		}
+		baseURL := os.Getenv("TELEGRAM_API_URL")
+		if baseURL == "" {
+			baseURL = defaultTelegramAPIURL
+		}
+		if err := validateHTTPURL(baseURL); err != nil {
+			return nil, fmt.Errorf("invalid TELEGRAM_API_URL: %w", err)
+		}
+		notifiers = append(notifiers, NewTelegramNotifier(baseURL, token, chatID))
+	}
+
+	return notifiers, nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// postWithRetry POSTs body to url, retrying with exponential backoff on
+// network errors, 429 and 5xx responses. header is applied to every attempt.
+func postWithRetry(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) error {
+	var lastErr error
+	for retry := 0; retry < notifyRetries; retry++ {
+		if retry > 0 {
+			// Exponential backoff: 1s, 2s
+			timer := time.NewTimer(notifyRetryDelay << uint(retry-1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			// Other client errors will not go away by retrying.
+			return lastErr
+		}
+	}
+	return fmt.Errorf("failed after %d retries: %w", notifyRetries, lastErr)
+}
+
+// violationTitle is the Vietnamese heading of each kind of change.
+var violationTitle = map[string]string{
+	"added":          "Vi phạm mới",
+	"status_changed": "Vi phạm đổi trạng thái",
+	"removed":        "Vi phạm không còn trên hệ thống CSGT",
+}
+
+// notificationSubject is a one-line Vietnamese summary of n.
+func notificationSubject(n Notification) string {
+	var parts []string
+	if count := len(n.Changes.Added); count > 0 {
+		parts = append(parts, strconv.Itoa(count)+" vi phạm mới")
+	}
+	if count := len(n.Changes.StatusChanged); count > 0 {
+		parts = append(parts, strconv.Itoa(count)+" đổi trạng thái")
+	}
+	if count := len(n.Changes.Removed); count > 0 {
+		parts = append(parts, strconv.Itoa(count)+" không còn")
+	}
+	subject := "Biển số " + n.Plate.Display()
+	if n.Label != "" {
+		subject += " (" + n.Label + ")"
+	}
+	return subject + ": " + strings.Join(parts, ", ")
+}
+
+// violationView is a violation as the email and Telegram messages show it.
+type violationView struct {
+	Plate           string
+	Time            string
+	Location        string
+	Behavior        string
+	Status          string
+	ResolutionPoint string
+}
+
+func newViolationView(v csgt.Violation) violationView {
+	return violationView{
+		Plate:           v.LicensePlate,
+		Time:            v.ViolationTime,
+		Location:        v.Location,
+		Behavior:        v.Behavior,
+		Status:          v.Status,
+		ResolutionPoint: v.ResolutionPoint,
+	}
+}
+
+func viewViolations(violations []csgt.Violation) []violationView {
+	views := make([]violationView, len(violations))
+	for i, v := range violations {
+		views[i] = newViolationView(v)
+	}
+	return views
+}
+
+func viewStatusChanges(changes []statusChange) []violationView {
+	views := make([]violationView, len(changes))
+	for i, change := range changes {
+		views[i] = newViolationView(change.Violation)
+		views[i].Status = change.OldStatus + " → " + change.NewStatus
+	}
+	return views
+}
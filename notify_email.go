@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"LicensePlatecheck/csgt"
+)
+
+const defaultSMTPPort = 587
+
+// smtpImplicitTLSPort is the port that speaks TLS from the first byte
+// (SMTPS); other ports upgrade with STARTTLS when the server offers it.
+const smtpImplicitTLSPort = 465
+
+// smtpConfig is where and as whom email notifications are sent.
+type smtpConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// EmailNotifier mails each notification as a Vietnamese HTML message.
+type EmailNotifier struct {
+	cfg smtpConfig
+}
+
+// NewEmailNotifier sends through the SMTP server in cfg.
+func NewEmailNotifier(cfg smtpConfig) *EmailNotifier {
+	return &EmailNotifier{cfg: cfg}
+}
+
+func (n *EmailNotifier) Name() string {
+	return "email"
+}
+
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html lang="vi">
+<head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body style="font-family: Arial, sans-serif; color: #222;">
+<h2>{{.Subject}}</h2>
+<p>Biển số <b>{{.Plate}}</b>{{if .Label}} ({{.Label}}){{end}} vừa được tra cứu lúc {{.CheckedAt}} và có thay đổi so với lần trước.</p>
+{{range .Sections}}
+<h3>{{.Title}}</h3>
+<table cellpadding="6" cellspacing="0" border="1" style="border-collapse: collapse; margin-bottom: 16px;">
+<tr style="background: #f2f2f2;">
+<th>Biển số</th><th>Thời gian vi phạm</th><th>Địa điểm</th><th>Hành vi</th><th>Trạng thái</th><th>Nơi giải quyết</th>
+</tr>
+{{range .Violations}}<tr>
+<td>{{.Plate}}</td><td>{{.Time}}</td><td>{{.Location}}</td><td>{{.Behavior}}</td><td>{{.Status}}</td><td>{{.ResolutionPoint}}</td>
+</tr>
+{{end}}</table>
+{{end}}
+<p style="color: #777; font-size: 12px;">Thông tin lấy từ website Cục CSGT (csgt.vn). Vui lòng đối chiếu trước khi nộp phạt.</p>
+</body>
+</html>
+`))
+
+type emailSection struct {
+	Title      string
+	Violations []violationView
+}
+
+// emailBody renders the HTML body of n.
+func emailBody(n Notification) (string, error) {
+	data := struct {
+		Subject   string
+		Plate     string
+		Label     string
+		CheckedAt string
+		Sections  []emailSection
+	}{
+		Subject:   notificationSubject(n),
+		Plate:     n.Plate.Display(),
+		Label:     n.Label,
+		CheckedAt: n.CheckedAt.In(csgt.Location).Format("15:04 02/01/2006"),
+	}
+	for _, section := range []emailSection{
+		{violationTitle["added"], viewViolations(n.Changes.Added)},
+		{violationTitle["status_changed"], viewStatusChanges(n.Changes.StatusChanged)},
+		{violationTitle["removed"], viewViolations(n.Changes.Removed)},
+	} {
+		if len(section.Violations) > 0 {
+			data.Sections = append(data.Sections, section)
+		}
+	}
+
+	var b strings.Builder
+	if err := emailTemplate.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error rendering email: %w", err)
+	}
+	return b.String(), nil
+}
+
+// emailMessage builds the RFC 5322 message for notification.
+func (n *EmailNotifier) emailMessage(notification Notification) ([]byte, error) {
+	body, err := emailBody(notification)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notificationSubject(notification)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	return msg.Bytes(), nil
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, notification Notification) error {
+	msg, err := n.emailMessage(notification)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for retry := 0; retry < notifyRetries; retry++ {
+		if retry > 0 {
+			// Exponential backoff: 1s, 2s
+			timer := time.NewTimer(notifyRetryDelay << uint(retry-1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if lastErr = n.send(ctx, msg); lastErr == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("failed after %d retries: %w", notifyRetries, lastErr)
+}
+
+// send delivers msg in one SMTP session.
+func (n *EmailNotifier) send(ctx context.Context, msg []byte) error {
+	addr := net.JoinHostPort(n.cfg.Host, strconv.Itoa(n.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: n.cfg.Host}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if n.cfg.Port == smtpImplicitTLSPort {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+	// net/smtp has no context support; a deadline bounds the whole session.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error starting SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if n.cfg.Port != smtpImplicitTLSPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("error starting TLS: %w", err)
+			}
+		}
+	}
+	if n.cfg.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted
+		// connection except to localhost.
+		if err := client.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)); err != nil {
+			return fmt.Errorf("error authenticating: %w", err)
+		}
+	}
+
+	if err := client.Mail(n.cfg.From); err != nil {
+		return fmt.Errorf("error setting sender: %w", err)
+	}
+	for _, to := range n.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("error adding recipient %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error starting message: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("error writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error sending message: %w", err)
+	}
+	return client.Quit()
+}
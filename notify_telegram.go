@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+const defaultTelegramAPIURL = "https://api.telegram.org"
+
+// telegramMessageLimit is the longest text sendMessage accepts.
+const telegramMessageLimit = 4096
+
+// TelegramNotifier sends each notification as a message from a bot through
+// the Telegram Bot API. The API base URL is configurable so a local stand-in
+// can be used.
+type TelegramNotifier struct {
+	baseURL string
+	token   string
+	chatID  string
+	client  *http.Client
+}
+
+// NewTelegramNotifier sends to chatID as the bot with token through the API
+// at baseURL, e.g. "https://api.telegram.org".
+func NewTelegramNotifier(baseURL, token, chatID string) *TelegramNotifier {
+	return &TelegramNotifier{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		chatID:  chatID,
+		client:  &http.Client{Timeout: notifyTimeout},
+	}
+}
+
+func (n *TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+func (n *TelegramNotifier) Notify(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  n.chatID,
+		"text":                     telegramText(notification),
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding message: %w", err)
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	err = postWithRetry(ctx, n.client, n.baseURL+"/bot"+n.token+"/sendMessage", header, body)
+	if err != nil {
+		// The token is part of the URL; keep it out of the logs.
+		return fmt.Errorf("sendMessage: %s", strings.ReplaceAll(err.Error(), n.token, "***"))
+	}
+	return nil
+}
+
+// telegramText renders n in the HTML subset Telegram supports.
+func telegramText(n Notification) string {
+	var b strings.Builder
+	b.WriteString("🚨 <b>" + html.EscapeString(notificationSubject(n)) + "</b>\n")
+
+	sections := []struct {
+		kind       string
+		violations []violationView
+	}{
+		{"added", viewViolations(n.Changes.Added)},
+		{"status_changed", viewStatusChanges(n.Changes.StatusChanged)},
+		{"removed", viewViolations(n.Changes.Removed)},
+	}
+	for _, section := range sections {
+		if len(section.violations) == 0 {
+			continue
+		}
+		b.WriteString("\n<b>" + violationTitle[section.kind] + "</b>\n")
+		for _, v := range section.violations {
+			b.WriteString("\n🚗 " + html.EscapeString(v.Plate) + "\n")
+			b.WriteString("🕒 " + html.EscapeString(v.Time) + "\n")
+			b.WriteString("📍 " + html.EscapeString(v.Location) + "\n")
+			b.WriteString("⚠️ " + html.EscapeString(v.Behavior) + "\n")
+			b.WriteString("📌 Trạng thái: " + html.EscapeString(v.Status) + "\n")
+			b.WriteString("🏢 Nơi giải quyết: " + html.EscapeString(v.ResolutionPoint) + "\n")
+		}
+	}
+
+	text := b.String()
+	if len(text) > telegramMessageLimit {
+		// Cut on a line boundary so no HTML tag or entity is split.
+		cut := strings.LastIndex(text[:telegramMessageLimit-4], "\n")
+		text = text[:cut] + "\n…"
+	}
+	return text
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/plate"
+)
+
+func testNotification(t *testing.T, added int) Notification {
+	t.Helper()
+	p, err := plate.Parse("98B378578")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := Notification{
+		Source:      notifySourceWatchlist,
+		Label:       "Xe <nhà>",
+		Plate:       p,
+		VehicleType: "2",
+		CheckedAt:   time.Date(2026, 10, 16, 1, 44, 0, 0, time.UTC),
+	}
+	for i := 0; i < added; i++ {
+		n.Changes.Added = append(n.Changes.Added, csgt.Violation{
+			LicensePlate:    "98B3-785.78",
+			ViolationTime:   "08:44, 16/10/2025",
+			Location:        "QL1A & QL3",
+			Behavior:        "Vượt đèn đỏ",
+			Status:          "Chưa xử phạt",
+			ResolutionPoint: "Đội CSGT số 1",
+		})
+	}
+	return n
+}
+
+// useFastRetries shortens the notification retry backoff for the test.
+func useFastRetries(t *testing.T) {
+	t.Helper()
+	delay := notifyRetryDelay
+	notifyRetryDelay = time.Millisecond
+	t.Cleanup(func() { notifyRetryDelay = delay })
+}
+
+func TestWebhookSignature(t *testing.T) {
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	notification := testNotification(t, 1)
+	if err := NewWebhookNotifier(server.URL, "s3cret").Notify(context.Background(), notification); err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp := header.Get("X-Notification-Timestamp")
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); header.Get("X-Signature-256") != want {
+		t.Errorf("X-Signature-256 = %q, want %q", header.Get("X-Signature-256"), want)
+	}
+	var got Notification
+	if err := json.Unmarshal(body, &got); err != nil || got.Plate != notification.Plate || len(got.Changes.Added) != 1 {
+		t.Errorf("body = %s (%v), want the notification", body, err)
+	}
+
+	// A signature over another timestamp must not verify.
+	if signWebhook([]byte("s3cret"), "0", body) == signWebhook([]byte("s3cret"), timestamp, body) {
+		t.Error("the signature does not cover the timestamp")
+	}
+
+	if err := NewWebhookNotifier(server.URL, "").Notify(context.Background(), notification); err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("X-Signature-256") != "" || header.Get("X-Notification-Timestamp") == "" {
+		t.Errorf("unsigned webhook headers = %v, want a timestamp and no signature", header)
+	}
+}
+
+func TestPostWithRetry(t *testing.T) {
+	useFastRetries(t)
+	tests := []struct {
+		name     string
+		statuses []int
+		calls    int32
+		wantErr  bool
+	}{
+		{name: "success", statuses: []int{200}, calls: 1},
+		{name: "server error is retried", statuses: []int{503, 502, 204}, calls: 3},
+		{name: "rate limit is retried", statuses: []int{429, 200}, calls: 2},
+		{name: "gives up after the retries", statuses: []int{500, 500, 500}, calls: 3, wantErr: true},
+		{name: "client error is not retried", statuses: []int{400}, calls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := atomic.AddInt32(&calls, 1)
+				if r.Header.Get("X-Test") != "yes" {
+					t.Errorf("call %d lost the header", call)
+				}
+				w.WriteHeader(tt.statuses[call-1])
+			}))
+			defer server.Close()
+
+			header := http.Header{"X-Test": {"yes"}}
+			err := postWithRetry(context.Background(), server.Client(), server.URL, header, []byte("{}"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("postWithRetry = %v, want error %v", err, tt.wantErr)
+			}
+			if calls != tt.calls {
+				t.Errorf("%d calls, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestPostWithRetryBackoff(t *testing.T) {
+	delay := notifyRetryDelay
+	notifyRetryDelay = 20 * time.Millisecond
+	defer func() { notifyRetryDelay = delay }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// 20ms, then 40ms between the three attempts.
+	started := time.Now()
+	if err := postWithRetry(context.Background(), server.Client(), server.URL, nil, nil); err == nil {
+		t.Fatal("postWithRetry succeeded against a failing server")
+	}
+	if elapsed := time.Since(started); elapsed < 60*time.Millisecond {
+		t.Errorf("retries took %v, want at least 60ms of backoff", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := postWithRetry(ctx, server.Client(), server.URL, nil, nil); err != context.DeadlineExceeded {
+		t.Errorf("postWithRetry with a short deadline = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestEmailMessage(t *testing.T) {
+	notifier := NewEmailNotifier(smtpConfig{From: "bot@example.com", To: []string{"a@example.com", "b@example.com"}})
+	notification := testNotification(t, 2)
+	raw, err := notifier.emailMessage(notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SMTP refuses lines over 998 characters; the base64 body is wrapped at
+	// 76.
+	header, encoded, _ := strings.Cut(string(raw), "\r\n\r\n")
+	for _, line := range strings.Split(header, "\r\n") {
+		if len(line) > 998 {
+			t.Fatalf("header line longer than 998 characters: %q", line)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(encoded, "\r\n"), "\r\n") {
+		if len(line) > 76 {
+			t.Fatalf("body line longer than 76 characters: %q", line)
+		}
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Header.Get("To"); got != "a@example.com, b@example.com" {
+		t.Errorf("To = %q", got)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != notificationSubject(notification) {
+		t.Errorf("Subject = %q (%v), want %q", subject, err, notificationSubject(notification))
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if got := msg.Header.Get("Content-Type"); got != "text/html; charset=UTF-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := msg.Header.Get("Content-Transfer-Encoding"); got != "base64" {
+		t.Fatalf("Content-Transfer-Encoding = %q", got)
+	}
+
+	body, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Xe &lt;nhà&gt;", "98B3-785.78", "QL1A &amp; QL3", "Vượt đèn đỏ", "Đội CSGT số 1", "08:44 16/10/2026", violationTitle["added"]} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("body lacks %q", want)
+		}
+	}
+	if strings.Contains(string(body), violationTitle["removed"]) {
+		t.Error("body has a section without violations")
+	}
+}
+
+func TestTelegramText(t *testing.T) {
+	text := telegramText(testNotification(t, 1))
+	for _, want := range []string{"Xe &lt;nhà&gt;", "QL1A &amp; QL3", "<b>" + violationTitle["added"] + "</b>"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text lacks %q:\n%s", want, text)
+		}
+	}
+
+	long := telegramText(testNotification(t, 100))
+	if len(long) > telegramMessageLimit {
+		t.Errorf("text is %d bytes, want at most %d", len(long), telegramMessageLimit)
+	}
+	if !strings.HasSuffix(long, "\n…") {
+		t.Errorf("truncated text ends with %q, want an ellipsis line", long[len(long)-20:])
+	}
+	// The cut falls between lines: the last kept line is one the message
+	// has in full.
+	lines := strings.Split(strings.TrimSuffix(long, "\n…"), "\n")
+	if last := lines[len(lines)-1]; !strings.Contains(text+"\n", "\n"+last+"\n") {
+		t.Errorf("cut inside a line: %q", last)
+	}
+	if strings.Count(long, "<b>") != strings.Count(long, "</b>") {
+		t.Error("truncation split a tag")
+	}
+}
+
+func TestTelegramNotify(t *testing.T) {
+	useFastRetries(t)
+	var message map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot123:secret/sendMessage" {
+			http.Error(w, "bad token at "+r.URL.Path, http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&message)
+	}))
+	defer server.Close()
+
+	if err := NewTelegramNotifier(server.URL+"/", "123:secret", "42").Notify(context.Background(), testNotification(t, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if message["chat_id"] != "42" || message["parse_mode"] != "HTML" || message["text"] == "" {
+		t.Errorf("sendMessage got %v", message)
+	}
+
+	err := NewTelegramNotifier(server.URL, "999:other", "42").Notify(context.Background(), testNotification(t, 1))
+	if err == nil || strings.Contains(err.Error(), "999:other") {
+		t.Errorf("Notify with a bad token = %v, want an error without the token", err)
+	}
+}
@@ -0,0 +1,158 @@
+// Package plate parses and normalizes Vietnamese civil license plates.
+//
+// A civil plate is a two-digit province code, a series of one or two letters
+// optionally followed by a digit, and a four- or five-digit serial number:
+//
+//	30A-123.45   province 30, series A,  serial 12345 (car)
+//	98B3-785.78  province 98, series B3, serial 78578 (motorbike)
+//	29LD-1234    province 29, series LD, serial 1234
+//
+// Parse accepts the forms users type ("98B3-785.78", "98b378578",
+// "98-B3 785.78") and produces the compact form CSGT expects in the lookup
+// form and the dotted display form CSGT prints on result pages.
+package plate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalid is wrapped by every error Parse returns.
+var ErrInvalid = errors.New("invalid license plate")
+
+// Letters never used in civil plate series.
+const excludedSeriesLetters = "IJOQW"
+
+// Plate is a parsed Vietnamese civil license plate.
+type Plate struct {
+	Province string // two-digit province code, e.g. "98"
+	Series   string // letters plus optional digit, e.g. "B3"
+	Serial   string // four or five digits, e.g. "78578"
+}
+
+// Parse reads a license plate, ignoring case, spaces, dots, dashes and
+// underscores. Separators also settle the one ambiguous case: "98B3-7857" is
+// series B3 with serial 7857, while "98B37857" is read as series B with the
+// modern five-digit serial 37857. Both have the same compact form.
+func Parse(s string) (Plate, error) {
+	var compact strings.Builder
+	// boundaries records compact-string offsets where a separator appeared.
+	boundaries := make(map[int]bool)
+
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r >= '0' && r <= '9', r >= 'A' && r <= 'Z':
+			compact.WriteRune(r)
+		case r >= 'a' && r <= 'z':
+			compact.WriteRune(r - 'a' + 'A')
+		case r == 'đ' || r == 'Đ':
+			compact.WriteRune('D')
+		case r == ' ' || r == '-' || r == '.' || r == '_':
+			boundaries[compact.Len()] = true
+		default:
+			return Plate{}, fmt.Errorf("%w: unexpected character %q in %q", ErrInvalid, r, s)
+		}
+	}
+
+	c := compact.String()
+	if len(c) < 2 || !isDigits(c[:2]) {
+		return Plate{}, fmt.Errorf("%w: %q must start with a two-digit province code", ErrInvalid, s)
+	}
+	province := c[:2]
+	if province < "11" {
+		return Plate{}, fmt.Errorf("%w: province code %s does not exist", ErrInvalid, province)
+	}
+
+	i := 2
+	for i < len(c) && i < 4 && isLetter(c[i]) {
+		i++
+	}
+	letters := c[2:i]
+	if letters == "" {
+		return Plate{}, fmt.Errorf("%w: %q has no series letter after the province code", ErrInvalid, s)
+	}
+	if strings.ContainsAny(letters, excludedSeriesLetters) {
+		return Plate{}, fmt.Errorf("%w: series %s uses a letter not issued on civil plates", ErrInvalid, letters)
+	}
+
+	digits := c[i:]
+	if !isDigits(digits) {
+		return Plate{}, fmt.Errorf("%w: %q has letters after the series", ErrInvalid, s)
+	}
+
+	var seriesDigit, serial string
+	switch len(digits) {
+	case 4:
+		serial = digits
+	case 5:
+		if boundaries[i+1] {
+			seriesDigit, serial = digits[:1], digits[1:]
+		} else {
+			serial = digits
+		}
+	case 6:
+		seriesDigit, serial = digits[:1], digits[1:]
+	default:
+		return Plate{}, fmt.Errorf("%w: %q needs a four- or five-digit serial number", ErrInvalid, s)
+	}
+
+	return Plate{
+		Province: province,
+		Series:   letters + seriesDigit,
+		Serial:   serial,
+	}, nil
+}
+
+// Normalize returns the compact form of s, or an error wrapping ErrInvalid.
+func Normalize(s string) (string, error) {
+	p, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return p.Compact(), nil
+}
+
+// Compact returns the form sent to CSGT, e.g. "98B378578".
+func (p Plate) Compact() string {
+	return p.Province + p.Series + p.Serial
+}
+
+// Display returns the dotted form CSGT prints, e.g. "98B3-785.78".
+func (p Plate) Display() string {
+	serial := p.Serial
+	if len(serial) == 5 {
+		serial = serial[:3] + "." + serial[3:]
+	}
+	return p.Province + p.Series + "-" + serial
+}
+
+// String implements fmt.Stringer using the display form.
+func (p Plate) String() string {
+	return p.Display()
+}
+
+// MarshalJSON writes the parsed parts together with both printed forms.
+func (p Plate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Province string `json:"province"`
+		Series   string `json:"series"`
+		Serial   string `json:"serial"`
+		Compact  string `json:"compact"`
+		Display  string `json:"display"`
+	}{p.Province, p.Series, p.Serial, p.Compact(), p.Display()})
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(b byte) bool {
+	return b >= 'A' && b <= 'Z'
+}
@@ -0,0 +1,59 @@
+package plate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Plate
+		compact string
+		display string
+	}{
+		{"98B3-785.78", Plate{"98", "B3", "78578"}, "98B378578", "98B3-785.78"},
+		{"98b378578", Plate{"98", "B3", "78578"}, "98B378578", "98B3-785.78"},
+		{"98-B3 785.78", Plate{"98", "B3", "78578"}, "98B378578", "98B3-785.78"},
+		{"  30A-123.45 ", Plate{"30", "A", "12345"}, "30A12345", "30A-123.45"},
+		{"29LD-1234", Plate{"29", "LD", "1234"}, "29LD1234", "29LD-1234"},
+		{"29đ1234", Plate{"29", "D", "1234"}, "29D1234", "29D-1234"},
+		{"98B3-7857", Plate{"98", "B3", "7857"}, "98B37857", "98B3-7857"},
+		{"98B37857", Plate{"98", "B", "37857"}, "98B37857", "98B-378.57"},
+		{"51_G_888.88", Plate{"51", "G", "88888"}, "51G88888", "51G-888.88"},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if c := got.Compact(); c != tt.compact {
+			t.Errorf("Parse(%q).Compact() = %q, want %q", tt.in, c, tt.compact)
+		}
+		if d := got.Display(); d != tt.display {
+			t.Errorf("Parse(%q).Display() = %q, want %q", tt.in, d, tt.display)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"A98B378578", // no province code
+		"09A12345",   // province code below 11
+		"30-12345",   // no series letter
+		"30I12345",   // letter not issued
+		"30AB1C234",  // letters after the series
+		"30A123",     // serial too short
+		"30A1234567", // serial too long
+		"30A/12345",  // unexpected character
+	} {
+		if p, err := Parse(in); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) = %+v, %v; want an error wrapping ErrInvalid", in, p, err)
+		}
+	}
+}
@@ -1,106 +1,360 @@
 package main
 
 import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
 )
 
-// RateLimiter controls the rate of requests
+// RateLimiter is a token bucket holding up to maxTokens tokens and gaining
+// one every refillRate. Refill is computed lazily on each call, so a limiter
+// costs no goroutine.
 type RateLimiter struct {
-	tokens     chan struct{}
 	maxTokens  int
 	refillRate time.Duration
 	mu         sync.Mutex
+	// tokens goes negative while callers wait for reserved tokens.
+	tokens float64
+	last   time.Time
 }
 
 // NewRateLimiter creates a new rate limiter
 func NewRateLimiter(maxTokens int, refillRate time.Duration) *RateLimiter {
-	rl := &RateLimiter{
-		tokens:     make(chan struct{}, maxTokens),
+	return &RateLimiter{
 		maxTokens:  maxTokens,
 		refillRate: refillRate,
+		tokens:     float64(maxTokens),
+		last:       time.Now(),
 	}
-	
-	// Fill initial tokens
-	for i := 0; i < maxTokens; i++ {
-		rl.tokens <- struct{}{}
-	}
-	
-	// Start refill goroutine
-	go rl.refill()
-	
-	return rl
 }
 
-func (rl *RateLimiter) refill() {
-	ticker := time.NewTicker(rl.refillRate)
-	defer ticker.Stop()
-	
-	for range ticker.C {
-		select {
-		case rl.tokens <- struct{}{}:
-		default:
-			// Token bucket is full
-		}
+// advance adds the tokens earned since the last call. It must be called with
+// rl.mu held.
+func (rl *RateLimiter) advance(now time.Time) {
+	if now.After(rl.last) {
+		rl.tokens += float64(now.Sub(rl.last)) / float64(rl.refillRate)
+		rl.last = now
+	}
+	if rl.tokens > float64(rl.maxTokens) {
+		rl.tokens = float64(rl.maxTokens)
 	}
 }
 
+// Close releases the limiter. The bucket refills lazily and owns no
+// goroutine, so there is nothing to stop; Close exists so callers can shut
+// limiters down uniformly.
+func (rl *RateLimiter) Close() {}
+
 // Wait blocks until a token is available
 func (rl *RateLimiter) Wait() {
-	<-rl.tokens
+	rl.WaitContext(context.Background())
 }
 
-// IPRateLimiter manages rate limiters per IP address
+// TryAcquire takes a token if one is available and reports whether it did.
+func (rl *RateLimiter) TryAcquire() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.advance(time.Now())
+	if rl.tokens < 1 {
+		return false
+	}
+	rl.tokens--
+	return true
+}
+
+// WaitContext blocks until a token is available or ctx is done. Waiters are
+// served in arrival order. When ctx has a deadline that falls before the
+// token would arrive, WaitContext returns context.DeadlineExceeded at once.
+func (rl *RateLimiter) WaitContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	rl.mu.Lock()
+	now := time.Now()
+	rl.advance(now)
+	rl.tokens--
+	delay := time.Duration(-rl.tokens * float64(rl.refillRate))
+	rl.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		rl.release()
+		return context.DeadlineExceeded
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		rl.release()
+		return ctx.Err()
+	}
+}
+
+// release returns a reserved token that will not be used.
+func (rl *RateLimiter) release() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.advance(time.Now())
+	rl.tokens++
+	if rl.tokens > float64(rl.maxTokens) {
+		rl.tokens = float64(rl.maxTokens)
+	}
+}
+
+// Limit returns the bucket size.
+func (rl *RateLimiter) Limit() int {
+	return rl.maxTokens
+}
+
+// Remaining returns the tokens currently available.
+func (rl *RateLimiter) Remaining() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.advance(time.Now())
+	return max(0, int(rl.tokens))
+}
+
+// RetryAfter returns how long until a token is free for a new caller.
+func (rl *RateLimiter) RetryAfter() time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.advance(time.Now())
+	if rl.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - rl.tokens) * float64(rl.refillRate))
+}
+
+// ResetAfter returns how long until the bucket is full again.
+func (rl *RateLimiter) ResetAfter() time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.advance(time.Now())
+	return time.Duration((float64(rl.maxTokens) - rl.tokens) * float64(rl.refillRate))
+}
+
+// ipLimiterEntry is one tracked key in the IPRateLimiter LRU list.
+type ipLimiterEntry struct {
+	ip         string
+	limiter    *RateLimiter
+	lastAccess time.Time
+}
+
+// IPRateLimiter manages rate limiters per IP address. It tracks at most
+// maxKeys addresses, dropping the least recently used one when full, and
+// forgets addresses idle for longer than idleTTL.
 type IPRateLimiter struct {
-	limiters map[string]*RateLimiter
-	mu       sync.RWMutex
+	limiters   map[string]*list.Element
+	lru        *list.List // front is most recently used
+	mu         sync.Mutex
 	maxTokens  int
 	refillRate time.Duration
+	idleTTL    time.Duration
+	maxKeys    int
+	done       chan struct{}
+	closeOnce  sync.Once
 }
 
 // NewIPRateLimiter creates a new IP-based rate limiter
-func NewIPRateLimiter(maxTokens int, refillRate time.Duration) *IPRateLimiter {
+func NewIPRateLimiter(maxTokens int, refillRate, idleTTL time.Duration, maxKeys int) *IPRateLimiter {
 	iprl := &IPRateLimiter{
-		limiters:   make(map[string]*RateLimiter),
+		limiters:   make(map[string]*list.Element),
+		lru:        list.New(),
 		maxTokens:  maxTokens,
 		refillRate: refillRate,
+		idleTTL:    idleTTL,
+		maxKeys:    maxKeys,
+		done:       make(chan struct{}),
 	}
-	
-	// Clean up old limiters every 5 minutes
+
+	// Evict idle limiters every minute
 	go iprl.cleanup()
-	
+
 	return iprl
 }
 
 // GetLimiter returns a rate limiter for the given IP
 func (iprl *IPRateLimiter) GetLimiter(ip string) *RateLimiter {
+	now := time.Now()
+
 	iprl.mu.Lock()
 	defer iprl.mu.Unlock()
-	
-	limiter, exists := iprl.limiters[ip]
-	if !exists {
-		limiter = NewRateLimiter(iprl.maxTokens, iprl.refillRate)
-		iprl.limiters[ip] = limiter
+
+	if elem, ok := iprl.limiters[ip]; ok {
+		entry := elem.Value.(*ipLimiterEntry)
+		entry.lastAccess = now
+		iprl.lru.MoveToFront(elem)
+		return entry.limiter
+	}
+
+	for iprl.lru.Len() >= iprl.maxKeys {
+		iprl.remove(iprl.lru.Back())
 	}
-	
-	return limiter
+	entry := &ipLimiterEntry{
+		ip:         ip,
+		limiter:    NewRateLimiter(iprl.maxTokens, iprl.refillRate),
+		lastAccess: now,
+	}
+	iprl.limiters[ip] = iprl.lru.PushFront(entry)
+	return entry.limiter
+}
+
+// Len returns the number of tracked addresses.
+func (iprl *IPRateLimiter) Len() int {
+	iprl.mu.Lock()
+	defer iprl.mu.Unlock()
+	return iprl.lru.Len()
 }
 
-// cleanup removes inactive rate limiters periodically
+// remove must be called with iprl.mu held.
+func (iprl *IPRateLimiter) remove(elem *list.Element) {
+	entry := iprl.lru.Remove(elem).(*ipLimiterEntry)
+	delete(iprl.limiters, entry.ip)
+}
+
+// cleanup removes idle rate limiters periodically
 func (iprl *IPRateLimiter) cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
-	
-	for range ticker.C {
-		iprl.mu.Lock()
-		// In production, you'd want to track last access time
-		// For now, we'll keep all limiters (they're lightweight)
-		iprl.mu.Unlock()
+
+	for {
+		var now time.Time
+		select {
+		case now = <-ticker.C:
+		case <-iprl.done:
+			return
+		}
+
+		iprl.evictIdle(now)
+	}
+}
+
+// evictIdle drops addresses not seen for idleTTL, walking from the least
+// recently used end of the list.
+func (iprl *IPRateLimiter) evictIdle(now time.Time) {
+	iprl.mu.Lock()
+	defer iprl.mu.Unlock()
+
+	for elem := iprl.lru.Back(); elem != nil; elem = iprl.lru.Back() {
+		if now.Sub(elem.Value.(*ipLimiterEntry).lastAccess) < iprl.idleTTL {
+			return
+		}
+		iprl.remove(elem)
 	}
 }
 
+// Close stops the cleanup goroutine.
+func (iprl *IPRateLimiter) Close() {
+	iprl.closeOnce.Do(func() {
+		close(iprl.done)
+	})
+}
+
+const (
+	defaultIPLimiterIdleTTL = 10 * time.Minute
+	defaultIPLimiterMaxKeys = 100000
+)
+
 // Global rate limiter - 200 requests per second for entire server
 var globalRateLimiter = NewRateLimiter(200, 5*time.Millisecond)
 
-// Per-IP rate limiter - 10 requests per second per IP
-var ipRateLimiter = NewIPRateLimiter(10, 100*time.Millisecond)
+// Per-IP rate limiter - 10 requests per second per IP; it is built in main.
+var ipRateLimiter *IPRateLimiter
+
+// errRateLimited is wrapped by every rateLimitError.
+var errRateLimited = errors.New("rate limit exceeded")
+
+// rateLimitError reports that a limiter had no token within the wait budget.
+type rateLimitError struct {
+	name    string // "global" or "ip"
+	limiter *RateLimiter
+}
+
+func (e *rateLimitError) Error() string {
+	switch e.name {
+	case "ip":
+		return fmt.Sprintf("per-IP %v", errRateLimited)
+	case "key":
+		return fmt.Sprintf("API key %v", errRateLimited)
+	}
+	return fmt.Sprintf("%s %v", e.name, errRateLimited)
+}
+
+func (e *rateLimitError) Unwrap() error {
+	return errRateLimited
+}
+
+type waitBudgetKey struct{}
+
+// withWaitBudget makes waitForToken give up after budget instead of blocking
+// until a token is free. Handlers set it in reject mode; background jobs do
+// not, so they keep waiting their turn.
+func withWaitBudget(ctx context.Context, budget time.Duration) context.Context {
+	return context.WithValue(ctx, waitBudgetKey{}, budget)
+}
+
+// waitBudgetFrom returns the wait budget ctx carries, if any.
+func waitBudgetFrom(ctx context.Context) (time.Duration, bool) {
+	budget, ok := ctx.Value(waitBudgetKey{}).(time.Duration)
+	return budget, ok
+}
+
+// waitForToken takes a token from limiter, recording the wait under the given
+// limiter label. When ctx carries a wait budget it returns a *rateLimitError
+// once the budget runs out; otherwise it waits until ctx is done.
+func waitForToken(ctx context.Context, limiter *RateLimiter, name string) error {
+	started := time.Now()
+	defer func() {
+		rateLimitWait.WithLabelValues(name).Observe(time.Since(started).Seconds())
+	}()
+
+	budget, ok := waitBudgetFrom(ctx)
+	if !ok {
+		return limiter.WaitContext(ctx)
+	}
+	if limiter.TryAcquire() {
+		return nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+	if err := limiter.WaitContext(waitCtx); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		rateLimitRejections.WithLabelValues(name).Inc()
+		return &rateLimitError{name: name, limiter: limiter}
+	}
+	return nil
+}
+
+// setRateLimitHeaders describes limiter in X-RateLimit-* response headers.
+func setRateLimitHeaders(w http.ResponseWriter, limiter *RateLimiter) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limiter.Limit()))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(limiter.Remaining()))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(limiter.ResetAfter())))
+}
+
+// writeRateLimited answers 429 for a request rejected by a limiter.
+func writeRateLimited(w http.ResponseWriter, err *rateLimitError) {
+	setRateLimitHeaders(w, err.limiter)
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(err.limiter.RetryAfter()))))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTryAcquire(t *testing.T) {
+	rl := NewRateLimiter(2, 20*time.Millisecond)
+	if !rl.TryAcquire() || !rl.TryAcquire() {
+		t.Fatal("a full bucket refused a token")
+	}
+	if rl.TryAcquire() {
+		t.Fatal("an empty bucket gave a token")
+	}
+	if got := rl.Remaining(); got != 0 {
+		t.Errorf("Remaining = %d, want 0", got)
+	}
+	if got := rl.RetryAfter(); got <= 0 || got > 20*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want up to 20ms", got)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !rl.TryAcquire() {
+		t.Error("no token after a refill period")
+	}
+}
+
+func TestRateLimiterWaitContext(t *testing.T) {
+	rl := NewRateLimiter(1, 20*time.Millisecond)
+	if err := rl.WaitContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+	if err := rl.WaitContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(started); waited < 10*time.Millisecond {
+		t.Errorf("second token after %v, want about 20ms", waited)
+	}
+}
+
+// TestRateLimiterReleasesOnCancel checks that a waiter who gives up hands
+// back the token it reserved, so the next caller does not wait for it.
+func TestRateLimiterReleasesOnCancel(t *testing.T) {
+	rl := NewRateLimiter(1, 50*time.Millisecond)
+	if !rl.TryAcquire() {
+		t.Fatal("a full bucket refused a token")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() { errs <- rl.WaitContext(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled WaitContext = %v, want %v", err, context.Canceled)
+	}
+
+	// Without the release the next token would be two periods away.
+	started := time.Now()
+	if err := rl.WaitContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(started); waited > 75*time.Millisecond {
+		t.Errorf("next waiter waited %v, want under one refill period", waited)
+	}
+}
+
+func TestRateLimiterDeadlineShortCircuit(t *testing.T) {
+	rl := NewRateLimiter(1, time.Hour)
+	if !rl.TryAcquire() {
+		t.Fatal("a full bucket refused a token")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	started := time.Now()
+	if err := rl.WaitContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitContext = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if waited := time.Since(started); waited > 100*time.Millisecond {
+		t.Errorf("WaitContext returned after %v, want at once", waited)
+	}
+	if got := rl.RetryAfter(); got > time.Hour {
+		t.Errorf("RetryAfter = %v, want the reserved token released", got)
+	}
+
+	cancel()
+	if err := rl.WaitContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitContext on a done context = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestWaitForTokenBudget(t *testing.T) {
+	rl := NewRateLimiter(1, time.Hour)
+	ctx := withWaitBudget(context.Background(), 10*time.Millisecond)
+	if err := waitForToken(ctx, rl, "ip"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := waitForToken(ctx, rl, "ip")
+	var rlErr *rateLimitError
+	if !errors.As(err, &rlErr) || !errors.Is(err, errRateLimited) {
+		t.Fatalf("waitForToken = %v, want a rate limit error", err)
+	}
+
+	rec := httptest.NewRecorder()
+	writeRateLimited(rec, rlErr)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	for header, want := range map[string]string{
+		"X-RateLimit-Limit":     "1",
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "3600",
+		"Retry-After":           "3600",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestIPRateLimiterEvictsLeastRecentlyUsed(t *testing.T) {
+	iprl := NewIPRateLimiter(1, time.Hour, time.Hour, 2)
+	defer iprl.Close()
+
+	a := iprl.GetLimiter("203.0.113.1")
+	a.TryAcquire()
+	iprl.GetLimiter("203.0.113.2")
+	if got := iprl.GetLimiter("203.0.113.1"); got != a {
+		t.Fatal("a tracked address got a new limiter")
+	}
+
+	// .2 is now the least recently used and makes room for .3.
+	iprl.GetLimiter("203.0.113.3")
+	if got := iprl.Len(); got != 2 {
+		t.Errorf("Len = %d, want 2", got)
+	}
+	if got := iprl.GetLimiter("203.0.113.1"); got != a || got.TryAcquire() {
+		t.Error("the recently used address lost its limiter")
+	}
+	iprl.mu.Lock()
+	_, kept := iprl.limiters["203.0.113.2"]
+	iprl.mu.Unlock()
+	if kept {
+		t.Error("the least recently used address was kept")
+	}
+}
+
+func TestIPRateLimiterEvictIdle(t *testing.T) {
+	iprl := NewIPRateLimiter(1, time.Hour, time.Minute, 10)
+	defer iprl.Close()
+
+	// Seen 10s apart, .3 last.
+	base := time.Now()
+	var recent *RateLimiter
+	for i, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		recent = iprl.GetLimiter(ip)
+		iprl.mu.Lock()
+		iprl.limiters[ip].Value.(*ipLimiterEntry).lastAccess = base.Add(time.Duration(i) * 10 * time.Second)
+		iprl.mu.Unlock()
+	}
+
+	iprl.evictIdle(base.Add(time.Minute - time.Nanosecond))
+	if got := iprl.Len(); got != 3 {
+		t.Fatalf("Len = %d before the idle TTL, want 3", got)
+	}
+
+	// .1 and .2 have been idle for exactly the TTL, .3 for less.
+	iprl.evictIdle(base.Add(10*time.Second + time.Minute))
+	if got := iprl.Len(); got != 1 {
+		t.Fatalf("Len = %d at the idle TTL, want 1", got)
+	}
+	iprl.mu.Lock()
+	elem, kept := iprl.limiters["203.0.113.3"]
+	iprl.mu.Unlock()
+	if !kept || elem.Value.(*ipLimiterEntry).limiter != recent {
+		t.Error("the recently seen address lost its limiter")
+	}
+}
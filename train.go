@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"LicensePlatecheck/csgt"
+)
+
+// runTrainCaptcha implements "train-captcha": it cuts glyph templates for the
+// builtin solver out of a directory of labelled captchas, then measures the
+// solver with them on captchas held out of the training.
+func runTrainCaptcha(args []string) error {
+	fs := flag.NewFlagSet("train-captcha", flag.ContinueOnError)
+	dir := fs.String("dir", "", "directory of labelled captchas (a CAPTCHA_DATASET_DIR or images named <answer>.png)")
+	out := fs.String("out", "glyphs.txt", "template file to write")
+	perChar := fs.Int("per-char", 3, "most templates kept per character")
+	holdout := fs.Float64("holdout", 0.2, "share of the captchas left out of training to measure the templates on")
+	preprocess := fs.String("preprocess", csgt.DefaultPreprocessing, "preprocessing pipeline the builtin solver will see, as one CAPTCHA_PREPROCESS entry")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return errors.New("-dir is required")
+	}
+	if *holdout < 0 || *holdout >= 1 {
+		return fmt.Errorf("-holdout must be at least 0 and below 1, got %g", *holdout)
+	}
+	pipeline, err := csgt.ParsePipeline("train", *preprocess)
+	if err != nil {
+		return fmt.Errorf("invalid captcha preprocessing configuration: %w", err)
+	}
+
+	samples, err := loadBenchSamples(*dir)
+	if err != nil {
+		return err
+	}
+
+	// Every sample whose index crosses a multiple of 1/holdout is held out,
+	// which spreads the test set evenly over the directory.
+	var train []csgt.TrainingCaptcha
+	var test []benchSample
+	for i, sample := range samples {
+		if int(float64(i+1)*(*holdout)) > int(float64(i)*(*holdout)) {
+			test = append(test, sample)
+			continue
+		}
+		train = append(train, csgt.TrainingCaptcha{Image: pipeline.Apply(sample.img), Answer: sample.answer})
+	}
+	if len(train) == 0 {
+		return fmt.Errorf("no labelled captchas to train on in %s", *dir)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	training, err := csgt.TrainGlyphTemplates(f, train, *perChar)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote %s: %s", *out, training)
+
+	if len(test) == 0 {
+		log.Printf("No captchas held out; measure the templates with bench-captcha before using them")
+		return nil
+	}
+	solver, err := csgt.NewGlyphSolver(*out)
+	if err != nil {
+		return err
+	}
+	report := &benchReport{
+		Dir:     fmt.Sprintf("%s (held out)", *dir),
+		Samples: len(test),
+		RanAt:   time.Now(),
+		Solvers: benchSolver(solver, []csgt.Pipeline{pipeline}, csgt.VoteMajority, test),
+	}
+	writeBenchText(os.Stdout, report)
+	return nil
+}
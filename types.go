@@ -1,91 +1,59 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"strings"
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/plate"
 )
 
-type OCRResponse struct {
-	ParsedResults []struct {
-		ParsedText string `json:"ParsedText"`
-	} `json:"ParsedResults"`
-	OCRExitCode           int    `json:"OCRExitCode"`
-	IsErroredOnProcessing bool   `json:"IsErroredOnProcessing"`
-	ErrorMessage          string `json:"ErrorMessage"`
+// lookupRequest is the body of a single plate lookup.
+type lookupRequest struct {
+	LicensePlate string `json:"license_plate"`
+	VehicleType  string `json:"vehicle_type"`
+	ForceRefresh bool   `json:"force_refresh"`
+	Since        string `json:"since"`
+	Until        string `json:"until"`
+	Sort         string `json:"sort"`
 }
 
-type SubmitFormResponse struct {
-	Success boolish `json:"success"`
-	Href    string  `json:"href"`
-	Error   string  `json:"error"`
-	Details *ResultDetails
+// parsedPlate validates the requested license plate.
+func (r lookupRequest) parsedPlate() (plate.Plate, error) {
+	return plate.Parse(r.LicensePlate)
 }
 
-type boolish bool
-
-type ResultDetails struct {
-	Message    string      `json:"message,omitempty"`
-	Violations []Violation `json:"violations,omitempty"`
+// violationFilter validates the requested since/until window and ordering.
+func (r lookupRequest) violationFilter() (violationFilter, error) {
+	return newViolationFilter(r.Since, r.Until, r.Sort)
 }
 
-type Violation struct {
-	LicensePlate    string `json:"license_plate"`
-	PlateColor      string `json:"plate_color"`
-	VehicleType     string `json:"vehicle_type"`
-	ViolationTime   string `json:"violation_time"`
-	Location        string `json:"location"`
-	Behavior        string `json:"behavior"`
-	Status          string `json:"status"`
-	DetectingUnit   string `json:"detecting_unit"`
-	ResolutionPoint string `json:"resolution_point"`
+// lookupResponse is the JSON answer for a single plate lookup.
+type lookupResponse struct {
+	Plate          *plate.Plate        `json:"plate,omitempty"`
+	Success        bool                `json:"success"`
+	Href           string              `json:"href"`
+	Error          string              `json:"error"`
+	Attempts       int                 `json:"attempts"`
+	Refreshes      int                 `json:"captcha_refreshes"`
+	ViolationCount int                 `json:"violation_count"`
+	Details        *csgt.ResultDetails `json:"details,omitempty"`
+	EstimatedFine  *csgt.FineEstimate  `json:"estimated_fine,omitempty"`
+	Cached         bool                `json:"cached"`
+	CacheAge       int                 `json:"cache_age_seconds"`
 }
 
-func (b *boolish) UnmarshalJSON(data []byte) error {
-	data = bytes.TrimSpace(data)
-	if len(data) == 0 {
-		*b = boolish(false)
-		return nil
-	}
-
-	if data[0] == '"' {
-		var s string
-		if err := json.Unmarshal(data, &s); err != nil {
-			return err
-		}
-		s = strings.TrimSpace(strings.ToLower(s))
-		switch s {
-		case "true", "1", "yes", "y":
-			*b = boolish(true)
-		default:
-			*b = boolish(false)
-		}
-		return nil
-	}
-
-	var boolVal bool
-	if err := json.Unmarshal(data, &boolVal); err == nil {
-		*b = boolish(boolVal)
-		return nil
-	}
-
-	var intVal int
-	if err := json.Unmarshal(data, &intVal); err == nil {
-		*b = boolish(intVal != 0)
-		return nil
+func newLookupResponse(p plate.Plate, outcome *lookupOutcome, filter violationFilter) lookupResponse {
+	result := outcome.Result
+	details := filter.apply(result.Details)
+	return lookupResponse{
+		Plate:          &p,
+		Success:        result.Success.Bool(),
+		Href:           result.Href,
+		Error:          result.Error,
+		Attempts:       outcome.Attempts,
+		Refreshes:      result.CaptchaRefreshes,
+		ViolationCount: getViolationCount(details),
+		Details:        details,
+		EstimatedFine:  estimateFines(details),
+		Cached:         outcome.Cached,
+		CacheAge:       int(outcome.Age.Seconds()),
 	}
-
-	return fmt.Errorf("boolish: cannot parse %s", string(data))
-}
-
-func (b boolish) MarshalJSON() ([]byte, error) {
-	if b {
-		return []byte("true"), nil
-	}
-	return []byte("false"), nil
-}
-
-func (b boolish) Bool() bool {
-	return bool(b)
 }
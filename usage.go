@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"LicensePlatecheck/csgt"
+)
+
+const (
+	defaultUsageFile = "usage.json"
+
+	usageFlushInterval = 30 * time.Second
+
+	// Daily counters older than this are dropped when the file is written.
+	usageDailyRetention = 62 * 24 * time.Hour
+
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// errQuotaExceeded is wrapped by every quotaError.
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// quotaError reports that an API key used up its daily or monthly quota.
+type quotaError struct {
+	period  string // "daily" or "monthly"
+	resetAt time.Time
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("%s %v, resets at %s", e.period, errQuotaExceeded, e.resetAt.Format(time.RFC3339))
+}
+
+func (e *quotaError) Unwrap() error {
+	return errQuotaExceeded
+}
+
+// keyUsage is what one API key has consumed. Daily and monthly lookups are
+// keyed by day ("2006-01-02") and month ("2006-01") in Vietnam time.
+type keyUsage struct {
+	Requests        int64            `json:"requests"`
+	Lookups         int64            `json:"lookups"`
+	CaptchaAttempts int64            `json:"captcha_attempts"`
+	CaptchaSkips    int64            `json:"captcha_skips"`
+	OCRSpaceCalls   int64            `json:"ocrspace_calls"`
+	Daily           map[string]int64 `json:"daily"`
+	Monthly         map[string]int64 `json:"monthly"`
+}
+
+// UsageStore counts usage per API key and persists it to a JSON file so
+// quotas survive restarts.
+type UsageStore struct {
+	path string
+
+	mu    sync.Mutex
+	usage map[string]*keyUsage
+	dirty bool
+
+	done      chan struct{}
+	flushed   chan struct{}
+	closeOnce sync.Once
+}
+
+// usageStore accounts API key usage; it is built in main.
+var usageStore *UsageStore
+
+// NewUsageStore loads the counters saved at path, if any, and writes them
+// back every 30 seconds while they change.
+func NewUsageStore(path string) (*UsageStore, error) {
+	s := &UsageStore{
+		path:    path,
+		usage:   make(map[string]*keyUsage),
+		done:    make(chan struct{}),
+		flushed: make(chan struct{}),
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("error reading usage file: %w", err)
+	default:
+		if err := json.Unmarshal(data, &s.usage); err != nil {
+			return nil, fmt.Errorf("error parsing usage file %s: %w", path, err)
+		}
+	}
+
+	go s.flushLoop()
+	return s, nil
+}
+
+// get must be called with s.mu held.
+func (s *UsageStore) get(name string) *keyUsage {
+	u, ok := s.usage[name]
+	if !ok {
+		u = &keyUsage{}
+		s.usage[name] = u
+	}
+	if u.Daily == nil {
+		u.Daily = make(map[string]int64)
+	}
+	if u.Monthly == nil {
+		u.Monthly = make(map[string]int64)
+	}
+	return u
+}
+
+// RecordRequest counts an authenticated request.
+func (s *UsageStore) RecordRequest(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(name).Requests++
+	s.dirty = true
+}
+
+// Consume charges one lookup to key, or returns a *quotaError when its daily
+// or monthly quota is used up.
+func (s *UsageStore) Consume(key *APIKey, now time.Time) error {
+	now = now.In(csgt.Location)
+	day, month := now.Format(dayLayout), now.Format(monthLayout)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.get(key.Name)
+	if key.DailyQuota > 0 && u.Daily[day] >= key.DailyQuota {
+		y, m, d := now.Date()
+		return &quotaError{period: "daily", resetAt: time.Date(y, m, d+1, 0, 0, 0, 0, csgt.Location)}
+	}
+	if key.MonthlyQuota > 0 && u.Monthly[month] >= key.MonthlyQuota {
+		y, m, _ := now.Date()
+		return &quotaError{period: "monthly", resetAt: time.Date(y, m+1, 1, 0, 0, 0, 0, csgt.Location)}
+	}
+
+	u.Lookups++
+	u.Daily[day]++
+	u.Monthly[month]++
+	s.dirty = true
+	return nil
+}
+
+// RecordCaptchaAttempts adds the captcha/submit attempts an upstream lookup
+// used on behalf of the named key.
+func (s *UsageStore) RecordCaptchaAttempts(name string, attempts int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(name).CaptchaAttempts += int64(attempts)
+	s.dirty = true
+}
+
+// RecordCaptchaSkip counts a captcha read for the named key that was
+// replaced by a fresh captcha instead of being submitted.
+func (s *UsageStore) RecordCaptchaSkip(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(name).CaptchaSkips++
+	s.dirty = true
+}
+
+// RecordOCRSpaceCall counts a paid OCR.space call made for the named key.
+func (s *UsageStore) RecordOCRSpaceCall(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(name).OCRSpaceCalls++
+	s.dirty = true
+}
+
+// Usage returns a copy of the named key's counters.
+func (s *UsageStore) Usage(name string) keyUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := *s.get(name)
+	u.Daily = maps.Clone(u.Daily)
+	u.Monthly = maps.Clone(u.Monthly)
+	return u
+}
+
+// Flush writes the counters to disk if they changed since the last flush.
+func (s *UsageStore) Flush() error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	s.prune(time.Now())
+	data, err := json.MarshalIndent(s.usage, "", "  ")
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error encoding usage: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		s.markDirty()
+		return fmt.Errorf("error writing usage file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		s.markDirty()
+		return fmt.Errorf("error writing usage file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		s.markDirty()
+		return fmt.Errorf("error writing usage file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		s.markDirty()
+		return fmt.Errorf("error writing usage file: %w", err)
+	}
+	return nil
+}
+
+func (s *UsageStore) markDirty() {
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+}
+
+// prune drops daily counters past their retention. It must be called with
+// s.mu held.
+func (s *UsageStore) prune(now time.Time) {
+	oldest := now.In(csgt.Location).Add(-usageDailyRetention).Format(dayLayout)
+	for _, u := range s.usage {
+		for day := range u.Daily {
+			if day < oldest {
+				delete(u.Daily, day)
+			}
+		}
+	}
+}
+
+func (s *UsageStore) flushLoop() {
+	defer close(s.flushed)
+
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+
+		if err := s.Flush(); err != nil {
+			log.Printf("usage: %v", err)
+		}
+	}
+}
+
+// Close stops the periodic flush and writes the counters one last time.
+func (s *UsageStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	<-s.flushed
+	return s.Flush()
+}
+
+// usageObserver charges upstream costs to the API key of the lookup.
+type usageObserver struct {
+	csgt.NopObserver
+}
+
+func (usageObserver) SolverAttempt(ctx context.Context, solver string, _ time.Duration, _ error) {
+	if key := apiKeyFrom(ctx); key != nil && solver == "ocrspace" {
+		usageStore.RecordOCRSpaceCall(key.Name)
+	}
+}
+
+func (usageObserver) CaptchaSkipped(ctx context.Context, _ string) {
+	if key := apiKeyFrom(ctx); key != nil {
+		usageStore.RecordCaptchaSkip(key.Name)
+	}
+}
+
+func (usageObserver) LookupFinished(ctx context.Context, _ *csgt.SubmitFormResponse, attempts int, _ error) {
+	if key := apiKeyFrom(ctx); key != nil && attempts > 0 {
+		usageStore.RecordCaptchaAttempts(key.Name, attempts)
+	}
+}
+
+// quotaReport is the use of one quota period in a /usage response.
+type quotaReport struct {
+	Period    string `json:"period"`
+	Used      int64  `json:"used"`
+	Quota     int64  `json:"quota,omitempty"`
+	Remaining *int64 `json:"remaining,omitempty"`
+}
+
+func newQuotaReport(period string, used, quota int64) quotaReport {
+	report := quotaReport{Period: period, Used: used, Quota: quota}
+	if quota > 0 {
+		remaining := max(0, quota-used)
+		report.Remaining = &remaining
+	}
+	return report
+}
+
+// usageReport is one key in a /usage response.
+type usageReport struct {
+	Name            string      `json:"name"`
+	Requests        int64       `json:"requests"`
+	Lookups         int64       `json:"lookups"`
+	CaptchaAttempts int64       `json:"captcha_attempts"`
+	CaptchaSkips    int64       `json:"captcha_skips"`
+	OCRSpaceCalls   int64       `json:"ocrspace_calls"`
+	Today           quotaReport `json:"today"`
+	ThisMonth       quotaReport `json:"this_month"`
+}
+
+func newUsageReport(key *APIKey, now time.Time) usageReport {
+	now = now.In(csgt.Location)
+	day, month := now.Format(dayLayout), now.Format(monthLayout)
+	u := usageStore.Usage(key.Name)
+	return usageReport{
+		Name:            key.Name,
+		Requests:        u.Requests,
+		Lookups:         u.Lookups,
+		CaptchaAttempts: u.CaptchaAttempts,
+		CaptchaSkips:    u.CaptchaSkips,
+		OCRSpaceCalls:   u.OCRSpaceCalls,
+		Today:           newQuotaReport(day, u.Daily[day], key.DailyQuota),
+		ThisMonth:       newQuotaReport(month, u.Monthly[month], key.MonthlyQuota),
+	}
+}
+
+// usageHandler reports the caller's usage, or every key's for admin keys.
+func usageHandler(w http.ResponseWriter, r *http.Request) {
+	key := apiKeyFrom(r.Context())
+	now := time.Now()
+
+	keys := []*APIKey{key}
+	if key.Admin {
+		keys = apiKeys.Keys()
+	}
+	reports := make([]usageReport, len(keys))
+	for i, k := range keys {
+		reports[i] = newUsageReport(k, now)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"keys": reports}); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// writeQuotaExceeded answers 429 for a key that used up its quota.
+func writeQuotaExceeded(w http.ResponseWriter, err *quotaError) {
+	retryAfter := int(math.Ceil(time.Until(err.resetAt).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, retryAfter)))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
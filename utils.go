@@ -1,66 +1,32 @@
 package main
 
 import (
-	"strings"
-	"unicode"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 
-	"golang.org/x/text/unicode/norm"
+	"LicensePlatecheck/csgt"
 )
 
-func normalizeLabel(s string) string {
-	s = strings.ReplaceAll(s, "\u00a0", " ")
-	s = strings.Join(strings.Fields(s), " ")
-	s = strings.TrimSuffix(s, ":")
-	s = strings.TrimSpace(s)
-	s = strings.ToLower(removeDiacritics(s))
-	return s
-}
-
-func normalizeMultiline(s string) string {
-	s = strings.ReplaceAll(s, "\u00a0", " ")
-	s = strings.ReplaceAll(s, "\r\n", "\n")
-	s = strings.ReplaceAll(s, "\r", "\n")
-	lines := strings.Split(s, "\n")
-	cleaned := make([]string, 0, len(lines))
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		line = strings.Join(strings.Fields(line), " ")
-		if line != "" {
-			cleaned = append(cleaned, line)
-		}
-	}
-	return strings.Join(cleaned, "\n")
-}
-
-func removeDiacritics(s string) string {
-	// Replace Vietnamese đ/Đ first
-	s = strings.ReplaceAll(s, "đ", "d")
-	s = strings.ReplaceAll(s, "Đ", "D")
-	
-	decomposed := norm.NFD.String(s)
-	builder := strings.Builder{}
-	for _, r := range decomposed {
-		if unicode.Is(unicode.Mn, r) {
-			continue
-		}
-		builder.WriteRune(r)
-	}
-	return builder.String()
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
+func estimateFines(details *csgt.ResultDetails) *csgt.FineEstimate {
+	if details == nil {
+		return nil
 	}
-	return b
+	return csgt.EstimateFines(details.Violations)
 }
 
-func getViolationCount(details *ResultDetails) int {
+func getViolationCount(details *csgt.ResultDetails) int {
 	if details == nil {
 		return 0
 	}
 	return len(details.Violations)
 }
+
+// newID returns a random 128-bit identifier for jobs and watchlist entries.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,642 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/plate"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultWatchInterval = 6 * time.Hour
+	defaultWatchJitter   = 30 * time.Minute
+	defaultWatchWorkers  = 2
+
+	// watchPollInterval is how often the scheduler looks for due entries.
+	watchPollInterval = 30 * time.Second
+
+	// minWatchDelay keeps a large jitter from scheduling checks back to back.
+	minWatchDelay = time.Minute
+)
+
+var watchlistBucket = []byte("watchlist")
+
+var (
+	errWatchNotFound  = errors.New("watchlist entry not found")
+	errWatchDuplicate = errors.New("plate is already on the watchlist")
+)
+
+// watcher rechecks watched plates; it is built in main.
+var watcher *Watcher
+
+// watchRequest is the body of POST /watchlist and PUT /watchlist/{id}.
+type watchRequest struct {
+	LicensePlate string `json:"license_plate"`
+	VehicleType  string `json:"vehicle_type"`
+	Label        string `json:"label"`
+}
+
+// WatchEntry is a plate rechecked on a schedule, with the violations found by
+// its last successful check.
+type WatchEntry struct {
+	ID           string           `json:"id"`
+	LicensePlate string           `json:"license_plate"`
+	Plate        plate.Plate      `json:"plate"`
+	VehicleType  string           `json:"vehicle_type"`
+	Label        string           `json:"label,omitempty"`
+	Owner        string           `json:"owner,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	NextCheckAt  time.Time        `json:"next_check_at"`
+	LastCheckAt  *time.Time       `json:"last_check_at,omitempty"`
+	LastError    string           `json:"last_error,omitempty"`
+	Violations   []csgt.Violation `json:"violations"`
+	// Checked is false until the first successful check stores Violations
+	// as the baseline later checks are compared with.
+	Checked      bool           `json:"checked"`
+	LastChange   *violationDiff `json:"last_change,omitempty"`
+	LastChangeAt *time.Time     `json:"last_change_at,omitempty"`
+}
+
+// statusChange is a violation whose status differs from the last check, for
+// example "Chưa xử phạt" → "Đã xử phạt".
+type statusChange struct {
+	Violation csgt.Violation `json:"violation"`
+	OldStatus string         `json:"old_status"`
+	NewStatus string         `json:"new_status"`
+}
+
+// violationDiff is what changed between two checks of a plate.
+type violationDiff struct {
+	Added         []csgt.Violation `json:"added,omitempty"`
+	Removed       []csgt.Violation `json:"removed,omitempty"`
+	StatusChanged []statusChange   `json:"status_changed,omitempty"`
+}
+
+// Empty reports whether nothing changed.
+func (d violationDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.StatusChanged) == 0
+}
+
+// diffViolations compares the violations of two checks, matching them by
+// fingerprint.
+func diffViolations(previous, current []csgt.Violation) violationDiff {
+	before := make(map[string]csgt.Violation, len(previous))
+	for _, v := range previous {
+		before[violationID(v)] = v
+	}
+
+	var diff violationDiff
+	seen := make(map[string]bool, len(current))
+	for _, v := range current {
+		id := violationID(v)
+		seen[id] = true
+		old, ok := before[id]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, v)
+		case old.Status != v.Status:
+			diff.StatusChanged = append(diff.StatusChanged, statusChange{
+				Violation: v,
+				OldStatus: old.Status,
+				NewStatus: v.Status,
+			})
+		}
+	}
+	for _, v := range previous {
+		if !seen[violationID(v)] {
+			diff.Removed = append(diff.Removed, v)
+		}
+	}
+	return diff
+}
+
+// Watcher stores watchlist entries and rechecks each one every interval,
+// give or take jitter, on a small pool of workers. Rechecks go through the
+// regular lookup path, so they wait for the global rate limiter like any
+// other upstream lookup.
+type Watcher struct {
+	db       *bolt.DB
+	interval time.Duration
+	jitter   time.Duration
+	workers  int
+
+	// onChange is called after a check finds changes. It is not called for
+	// the baseline check, like notifyLookupChanges stays silent for a plate
+	// without earlier history.
+	onChange func(entry WatchEntry, diff violationDiff)
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped chan struct{}
+	checks  sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// NewWatcher prepares db for watchlist entries. Call Start to begin
+// rechecking.
+func NewWatcher(db *bolt.DB, interval, jitter time.Duration, workers int) (*Watcher, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(watchlistBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error preparing watchlist store: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Watcher{
+		db:       db,
+		interval: interval,
+		jitter:   jitter,
+		workers:  workers,
+		onChange: notifyWatchChange,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		running:  make(map[string]bool),
+	}, nil
+}
+
+// notifyWatchChange logs what a check found and sends it to the notification
+// channels.
+func notifyWatchChange(entry WatchEntry, diff violationDiff) {
+	log.Printf("watchlist %s (%s): %d added, %d removed, %d status changed",
+		entry.ID, entry.Plate, len(diff.Added), len(diff.Removed), len(diff.StatusChanged))
+	notifications.Send(Notification{
+		Source:      notifySourceWatchlist,
+		WatchID:     entry.ID,
+		Label:       entry.Label,
+		Plate:       entry.Plate,
+		VehicleType: entry.VehicleType,
+		CheckedAt:   *entry.LastCheckAt,
+		Changes:     diff,
+	})
+}
+
+// nextCheck returns when to check again after now.
+func (w *Watcher) nextCheck(now time.Time) time.Time {
+	delay := w.interval
+	if w.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(2*w.jitter))) - w.jitter
+	}
+	return now.Add(max(delay, minWatchDelay))
+}
+
+func (w *Watcher) put(tx *bolt.Tx, entry *WatchEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding watchlist entry: %w", err)
+	}
+	return tx.Bucket(watchlistBucket).Put([]byte(entry.ID), value)
+}
+
+func (w *Watcher) get(tx *bolt.Tx, id string) (*WatchEntry, error) {
+	value := tx.Bucket(watchlistBucket).Get([]byte(id))
+	if value == nil {
+		return nil, errWatchNotFound
+	}
+	var entry WatchEntry
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return nil, fmt.Errorf("error decoding watchlist entry %s: %w", id, err)
+	}
+	return &entry, nil
+}
+
+func (w *Watcher) forEach(tx *bolt.Tx, fn func(*WatchEntry) error) error {
+	return tx.Bucket(watchlistBucket).ForEach(func(key, value []byte) error {
+		var entry WatchEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return fmt.Errorf("error decoding watchlist entry %s: %w", key, err)
+		}
+		return fn(&entry)
+	})
+}
+
+// Add watches a plate for owner, checking it for the first time right away.
+func (w *Watcher) Add(req watchRequest, p plate.Plate, owner string) (WatchEntry, error) {
+	id, err := newID()
+	if err != nil {
+		return WatchEntry{}, err
+	}
+	now := time.Now()
+	entry := &WatchEntry{
+		ID:           id,
+		LicensePlate: req.LicensePlate,
+		Plate:        p,
+		VehicleType:  req.VehicleType,
+		Label:        req.Label,
+		Owner:        owner,
+		CreatedAt:    now,
+		NextCheckAt:  now,
+		Violations:   []csgt.Violation{},
+	}
+
+	err = w.db.Update(func(tx *bolt.Tx) error {
+		err := w.forEach(tx, func(other *WatchEntry) error {
+			if other.Owner == owner && other.Plate == p && other.VehicleType == req.VehicleType {
+				return errWatchDuplicate
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return w.put(tx, entry)
+	})
+	if err != nil {
+		return WatchEntry{}, err
+	}
+	return *entry, nil
+}
+
+// Get returns the entry with the given id if it belongs to owner.
+func (w *Watcher) Get(id, owner string) (WatchEntry, error) {
+	var entry *WatchEntry
+	err := w.db.View(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = w.get(tx, id)
+		return err
+	})
+	if err != nil {
+		return WatchEntry{}, err
+	}
+	if entry.Owner != owner {
+		return WatchEntry{}, errWatchNotFound
+	}
+	return *entry, nil
+}
+
+// List returns owner's entries, oldest first.
+func (w *Watcher) List(owner string) ([]WatchEntry, error) {
+	entries := []WatchEntry{}
+	err := w.db.View(func(tx *bolt.Tx) error {
+		return w.forEach(tx, func(entry *WatchEntry) error {
+			if entry.Owner == owner {
+				entries = append(entries, *entry)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+// Update replaces the plate, vehicle type and label of owner's entry.
+// Changing the plate or vehicle type starts a fresh baseline with an
+// immediate check.
+func (w *Watcher) Update(id, owner string, req watchRequest, p plate.Plate) (WatchEntry, error) {
+	var entry *WatchEntry
+	err := w.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = w.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if entry.Owner != owner {
+			return errWatchNotFound
+		}
+
+		if entry.Plate != p || entry.VehicleType != req.VehicleType {
+			entry.Violations = []csgt.Violation{}
+			entry.Checked = false
+			entry.LastChange = nil
+			entry.LastChangeAt = nil
+			entry.NextCheckAt = time.Now()
+		}
+		entry.LicensePlate = req.LicensePlate
+		entry.Plate = p
+		entry.VehicleType = req.VehicleType
+		entry.Label = req.Label
+		return w.put(tx, entry)
+	})
+	if err != nil {
+		return WatchEntry{}, err
+	}
+	return *entry, nil
+}
+
+// Delete removes owner's entry.
+func (w *Watcher) Delete(id, owner string) error {
+	return w.db.Update(func(tx *bolt.Tx) error {
+		entry, err := w.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if entry.Owner != owner {
+			return errWatchNotFound
+		}
+		return tx.Bucket(watchlistBucket).Delete([]byte(id))
+	})
+}
+
+// Start runs the scheduler until Shutdown.
+func (w *Watcher) Start() {
+	go w.loop()
+}
+
+func (w *Watcher) loop() {
+	defer close(w.stopped)
+
+	slots := make(chan struct{}, w.workers)
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, id := range w.due(time.Now()) {
+			select {
+			case slots <- struct{}{}:
+			case <-w.done:
+				return
+			}
+			w.checks.Add(1)
+			go func() {
+				defer w.checks.Done()
+				defer func() { <-slots }()
+				w.check(id)
+			}()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// due returns the ids of entries whose next check has come and that are not
+// being checked already, marking them as running.
+func (w *Watcher) due(now time.Time) []string {
+	var ids []string
+	err := w.db.View(func(tx *bolt.Tx) error {
+		return w.forEach(tx, func(entry *WatchEntry) error {
+			if !entry.NextCheckAt.After(now) {
+				ids = append(ids, entry.ID)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("watchlist: error listing due entries: %v", err)
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var ready []string
+	for _, id := range ids {
+		if !w.running[id] {
+			w.running[id] = true
+			ready = append(ready, id)
+		}
+	}
+	return ready
+}
+
+// check looks a watched plate up again and stores what changed.
+func (w *Watcher) check(id string) {
+	defer func() {
+		w.mu.Lock()
+		delete(w.running, id)
+		w.mu.Unlock()
+	}()
+
+	var entry *WatchEntry
+	err := w.db.View(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = w.get(tx, id)
+		return err
+	})
+	if err != nil {
+		// Deleted while queued.
+		return
+	}
+
+	ctx := withWatchCheck(w.ctx)
+	if entry.Owner != "" && apiKeys != nil {
+		if key := apiKeys.Named(entry.Owner); key != nil {
+			ctx = withAPIKey(ctx, key)
+		}
+	}
+	if lookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lookupTimeout)
+		defer cancel()
+	}
+
+	outcome, lookupErr := lookupLicensePlate(ctx, entry.Plate, entry.VehicleType, true)
+	switch {
+	case lookupErr != nil:
+	case !outcome.Result.Success.Bool():
+		lookupErr = fmt.Errorf("lookup failed: %s", outcome.Result.Error)
+	case outcome.Result.Href != "" && outcome.Result.Details == nil:
+		// Without a readable result page every violation would look removed.
+		lookupErr = errors.New("result page unavailable")
+	}
+	if w.ctx.Err() != nil {
+		// Shutting down; leave the entry due so it is checked after restart.
+		return
+	}
+
+	now := time.Now()
+	var diff violationDiff
+	var changed *WatchEntry
+	err = w.db.Update(func(tx *bolt.Tx) error {
+		current, err := w.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if current.Plate != entry.Plate || current.VehicleType != entry.VehicleType {
+			// Edited during the lookup: Update started a fresh baseline and
+			// made the entry due, so this result belongs to the old plate.
+			return nil
+		}
+		current.LastCheckAt = &now
+		current.NextCheckAt = w.nextCheck(now)
+		if lookupErr != nil {
+			current.LastError = lookupErr.Error()
+			return w.put(tx, current)
+		}
+
+		var violations []csgt.Violation
+		if outcome.Result.Details != nil {
+			violations = outcome.Result.Details.Violations
+		}
+		if violations == nil {
+			violations = []csgt.Violation{}
+		}
+		current.LastError = ""
+		if !current.Checked {
+			// The first check is the baseline: violations that are already
+			// there when a plate is added are not changes.
+			current.Violations = violations
+			current.Checked = true
+			return w.put(tx, current)
+		}
+		diff = diffViolations(current.Violations, violations)
+		current.Violations = violations
+		current.Checked = true
+		if !diff.Empty() {
+			current.LastChange = &diff
+			current.LastChangeAt = &now
+			changed = current
+		}
+		return w.put(tx, current)
+	})
+	if err != nil {
+		if !errors.Is(err, errWatchNotFound) {
+			log.Printf("watchlist: error saving check of %s: %v", id, err)
+		}
+		return
+	}
+
+	if changed != nil && w.onChange != nil {
+		w.onChange(*changed, diff)
+	}
+}
+
+// Shutdown stops scheduling checks and waits for running ones. When ctx is
+// done first the remaining lookups are cancelled.
+func (w *Watcher) Shutdown(ctx context.Context) error {
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+	}
+	<-w.stopped
+
+	finished := make(chan struct{})
+	go func() {
+		w.checks.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		w.cancel()
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+// watchOwner is the API key name entries are filed under, or "" when
+// authentication is off.
+func watchOwner(r *http.Request) string {
+	if key := apiKeyFrom(r.Context()); key != nil {
+		return key.Name
+	}
+	return ""
+}
+
+func writeWatchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errWatchNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errWatchDuplicate):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("watchlist: %v", err)
+		http.Error(w, "Error accessing watchlist", http.StatusInternalServerError)
+	}
+}
+
+func writeWatchJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error encoding watchlist response: %v", err)
+	}
+}
+
+// decodeWatchRequest reads and validates a watchlist request body.
+func decodeWatchRequest(r *http.Request) (watchRequest, plate.Plate, error) {
+	var req watchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, plate.Plate{}, errors.New("Invalid request body")
+	}
+	p, err := plate.Parse(req.LicensePlate)
+	if err != nil {
+		return req, plate.Plate{}, err
+	}
+	return req, p, nil
+}
+
+func createWatchHandler(w http.ResponseWriter, r *http.Request) {
+	req, p, err := decodeWatchRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry, err := watcher.Add(req, p, watchOwner(r))
+	if err != nil {
+		writeWatchError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/watchlist/"+entry.ID)
+	writeWatchJSON(w, http.StatusCreated, entry)
+}
+
+func listWatchHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := watcher.List(watchOwner(r))
+	if err != nil {
+		writeWatchError(w, err)
+		return
+	}
+	writeWatchJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
+
+func getWatchHandler(w http.ResponseWriter, r *http.Request) {
+	entry, err := watcher.Get(r.PathValue("id"), watchOwner(r))
+	if err != nil {
+		writeWatchError(w, err)
+		return
+	}
+	writeWatchJSON(w, http.StatusOK, entry)
+}
+
+func updateWatchHandler(w http.ResponseWriter, r *http.Request) {
+	req, p, err := decodeWatchRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry, err := watcher.Update(r.PathValue("id"), watchOwner(r), req, p)
+	if err != nil {
+		writeWatchError(w, err)
+		return
+	}
+	writeWatchJSON(w, http.StatusOK, entry)
+}
+
+func deleteWatchHandler(w http.ResponseWriter, r *http.Request) {
+	if err := watcher.Delete(r.PathValue("id"), watchOwner(r)); err != nil {
+		writeWatchError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
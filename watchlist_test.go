@@ -0,0 +1,152 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"LicensePlatecheck/csgt"
+	"LicensePlatecheck/internal/fakecsgt"
+	"LicensePlatecheck/plate"
+)
+
+func TestDiffViolations(t *testing.T) {
+	speeding := csgt.Violation{ID: "speeding", Status: "Chưa xử phạt"}
+	redLight := csgt.Violation{ID: "red-light", Status: "Chưa xử phạt"}
+	parking := csgt.Violation{ID: "parking", Status: "Đã xử phạt"}
+	paid := speeding
+	paid.Status = "Đã xử phạt"
+
+	tests := []struct {
+		name              string
+		previous, current []csgt.Violation
+		added, removed    []string
+		statusChanged     []string
+	}{
+		{name: "nothing before or after"},
+		{name: "unchanged", previous: []csgt.Violation{speeding, redLight}, current: []csgt.Violation{redLight, speeding}},
+		{name: "added", previous: []csgt.Violation{speeding}, current: []csgt.Violation{speeding, redLight}, added: []string{"red-light"}},
+		{name: "removed", previous: []csgt.Violation{speeding, parking}, current: []csgt.Violation{speeding}, removed: []string{"parking"}},
+		{name: "status changed", previous: []csgt.Violation{speeding}, current: []csgt.Violation{paid}, statusChanged: []string{"speeding"}},
+		{
+			name:          "everything at once",
+			previous:      []csgt.Violation{speeding, parking},
+			current:       []csgt.Violation{paid, redLight},
+			added:         []string{"red-light"},
+			removed:       []string{"parking"},
+			statusChanged: []string{"speeding"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffViolations(tt.previous, tt.current)
+			checkIDs(t, "added", diff.Added, tt.added)
+			checkIDs(t, "removed", diff.Removed, tt.removed)
+			var changed []csgt.Violation
+			for _, change := range diff.StatusChanged {
+				changed = append(changed, change.Violation)
+			}
+			checkIDs(t, "status changed", changed, tt.statusChanged)
+			if diff.Empty() != (len(tt.added)+len(tt.removed)+len(tt.statusChanged) == 0) {
+				t.Errorf("Empty() = %v for %+v", diff.Empty(), diff)
+			}
+		})
+	}
+}
+
+func TestDiffViolationsStatusChange(t *testing.T) {
+	before := csgt.Violation{ID: "a", Status: "Chưa xử phạt"}
+	after := csgt.Violation{ID: "a", Status: "Đã xử phạt"}
+	diff := diffViolations([]csgt.Violation{before}, []csgt.Violation{after})
+	if len(diff.StatusChanged) != 1 {
+		t.Fatalf("got %+v, want one status change", diff)
+	}
+	change := diff.StatusChanged[0]
+	if change.OldStatus != before.Status || change.NewStatus != after.Status || change.Violation.Status != after.Status {
+		t.Errorf("status change = %+v, want %q → %q", change, before.Status, after.Status)
+	}
+}
+
+// TestDiffViolationsFingerprint matches violations without an ID by their
+// fingerprint.
+func TestDiffViolationsFingerprint(t *testing.T) {
+	v := csgt.Violation{LicensePlate: "98B3-785.78", ViolationTime: "08:44, 16/10/2025", Location: "QL1A", Behavior: "Vượt đèn đỏ"}
+	same := v
+	same.LicensePlate = "98b378578"
+	if diff := diffViolations([]csgt.Violation{v}, []csgt.Violation{same}); !diff.Empty() {
+		t.Errorf("got %+v, want no changes", diff)
+	}
+}
+
+func checkIDs(t *testing.T, what string, got []csgt.Violation, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s = %d violations, want %v", what, len(got), want)
+		return
+	}
+	for i, v := range got {
+		if v.ID != want[i] {
+			t.Errorf("%s[%d] = %q, want %q", what, i, v.ID, want[i])
+		}
+	}
+}
+
+// TestWatcherDropsStaleCheck edits an entry's plate while its check is
+// waiting for upstream: the result belongs to the old plate and must not
+// become the new plate's baseline.
+func TestWatcherDropsStaleCheck(t *testing.T) {
+	useFakeUpstream(t, fakecsgt.Config{
+		PlateScenarios: map[string]fakecsgt.Scenario{"98B378578": fakecsgt.ScenarioSlow},
+		Delay:          200 * time.Millisecond,
+	})
+	db, err := openDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	w, err := NewWatcher(db, time.Hour, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.onChange = nil
+
+	parse := func(licensePlate string) plate.Plate {
+		p, err := plate.Parse(licensePlate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	entry, err := w.Add(watchRequest{LicensePlate: "98B378578", VehicleType: "2"}, parse("98B378578"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checked := make(chan struct{})
+	go func() {
+		w.check(entry.ID)
+		close(checked)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := w.Update(entry.ID, "", watchRequest{LicensePlate: "30A12345", VehicleType: "2"}, parse("30A12345")); err != nil {
+		t.Fatal(err)
+	}
+	<-checked
+
+	got, err := w.Get(entry.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Checked || len(got.Violations) != 0 || got.LastCheckAt != nil || got.NextCheckAt.After(time.Now()) {
+		t.Fatalf("entry = %+v, want the old plate's result dropped and the new plate due", got)
+	}
+
+	w.check(entry.ID)
+	got, err = w.Get(entry.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Checked || len(got.Violations) != 0 || got.LastCheckAt == nil {
+		t.Errorf("entry = %+v, want the new plate's baseline without violations", got)
+	}
+}